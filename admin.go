@@ -0,0 +1,120 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// reloadHandler starts updating the databases, or only the one named by the "edition" query parameter, responding
+// 202 with their current status: the outcome is in /admin/update-status. A database already being updated (reloaded
+// or checked on schedule) is a 409, none of them is then started.
+func reloadHandler(databases []*maxmind, creds *maxmindCredentials) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		edition := r.URL.Query().Get("edition")
+		var selected []*maxmind
+		for _, m := range databases {
+			if edition != "" && m.edition != edition {
+				continue
+			}
+			if !m.updating.TryLock() {
+				for _, locked := range selected {
+					locked.updating.Unlock()
+				}
+				errResponse(w, http.StatusConflict, ERR_UPDATE_RUNNING, fmt.Sprintf("Edition '%s' is already being updated, see /admin/update-status", m.edition))
+				return
+			}
+			selected = append(selected, m)
+		}
+		if selected == nil {
+			errResponse(w, http.StatusNotFound, ERR_EDITION_NOT_LOADED, "Edition not loaded")
+			return
+		}
+
+		accountId, license := creds.get()
+		var resp []databaseReadinessStruct
+		for _, m := range selected {
+			log.Info().Msg(fmt.Sprintf("Reload requested (edition: '%s')", m.edition))
+			resp = append(resp, m.readiness())
+			go func() {
+				defer m.updating.Unlock()
+				m.updateLocked(accountId, license)
+			}()
+		}
+
+		status := "/admin/update-status"
+		if edition != "" {
+			status += "?edition=" + url.QueryEscape(edition)
+		}
+		w.Header().Set("Location", status)
+		w.WriteHeader(http.StatusAccepted)
+		geoResponse(w, resp)
+	}
+}
+
+// rollbackHandler rolls back the database of the "edition" query parameter (optional with a single one) to the kept
+// version of the "build" one (its build epoch), or else to the previous version, responding with the metadata of the
+// database now loaded
+func rollbackHandler(databases []*maxmind) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		var build uint64
+		if value := query.Get("build"); value != "" {
+			var err error
+			if build, err = strconv.ParseUint(value, 10, 64); err != nil {
+				errResponse(w, http.StatusBadRequest, ERR_INVALID_BUILD, "Invalid build, expected the build_epoch of a version")
+				return
+			}
+		}
+
+		edition := query.Get("edition")
+		for _, m := range databases {
+			if m.edition != edition && (edition != "" || len(databases) > 1) {
+				continue
+			}
+			log.Info().Msg(fmt.Sprintf("Rollback requested (edition: '%s')", m.edition))
+			if err := m.rollbackAndReload(uint(build)); err != nil {
+				log.Error().Err(err).Msg(fmt.Sprintf("Rollback failed (edition: '%s')", m.edition))
+				errResponse(w, http.StatusConflict, ERR_ROLLBACK_FAILED, "Rollback failed, see the versions in /dbinfo")
+				return
+			}
+			geoResponse(w, m.info())
+			return
+		}
+		errResponse(w, http.StatusNotFound, ERR_EDITION_NOT_LOADED, "Edition not loaded")
+	}
+}
+
+// debugHandler serves the net/http/pprof profiles under /debug/pprof/ and the expvar variables under /debug/vars
+func debugHandler() httprouter.Handle {
+	vars := expvar.Handler()
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if r.URL.Path == "/debug/vars" {
+			vars.ServeHTTP(w, r)
+			return
+		}
+		switch ps.ByName("profile") {
+		case "/cmdline":
+			pprof.Cmdline(w, r)
+		case "/profile":
+			pprof.Profile(w, r)
+		case "/symbol":
+			pprof.Symbol(w, r)
+		case "/trace":
+			pprof.Trace(w, r)
+		default:
+			// The index, and the named profiles (ex: /debug/pprof/heap)
+			pprof.Index(w, r)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/rs/zerolog/log"
+)
+
+// anonymousIPStruct are the fields of the GeoIP2-Anonymous-IP edition, added to the city responses when it is loaded
+type anonymousIPStruct struct {
+	IsAnonymous        bool `json:"is_anonymous"`
+	IsAnonymousVPN     bool `json:"is_anonymous_vpn"`
+	IsHostingProvider  bool `json:"is_hosting_provider"`
+	IsPublicProxy      bool `json:"is_public_proxy"`
+	IsResidentialProxy bool `json:"is_residential_proxy"`
+	IsTorExitNode      bool `json:"is_tor_exit_node"`
+}
+
+type anonymousIPResponseStruct struct {
+	IP string `json:"ip"`
+	*anonymousIPStruct
+}
+
+// isAnonymousIP reports whether the database supports anonymous IP lookups (Anonymous-IP edition)
+func (m *maxmind) isAnonymousIP() bool {
+	db := m.acquire()
+	defer db.release()
+	_, err := db.AnonymousIP(net.IPv4zero)
+	return !errors.As(err, &geoip2.InvalidMethodError{})
+}
+
+func (m *maxmind) anonymousIP(ctx context.Context, ip net.IP) (*anonymousIPStruct, error) {
+	record, err := m.record(ctx, "anonymous", ip, func(db *sharedReader) (interface{}, error) {
+		return db.AnonymousIP(ip)
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return nil, err
+	}
+	anonymous := record.(*geoip2.AnonymousIP)
+
+	return &anonymousIPStruct{
+		IsAnonymous:        anonymous.IsAnonymous,
+		IsAnonymousVPN:     anonymous.IsAnonymousVPN,
+		IsHostingProvider:  anonymous.IsHostingProvider,
+		IsPublicProxy:      anonymous.IsPublicProxy,
+		IsResidentialProxy: anonymous.IsResidentialProxy,
+		IsTorExitNode:      anonymous.IsTorExitNode,
+	}, nil
+}
+
+func (m *maxmind) lookupAnonymousIP(ctx context.Context, ipStr string, ip net.IP, _ []string) (interface{}, error) {
+	anonymous, err := m.anonymousIP(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	return anonymousIPResponseStruct{IP: ipStr, anonymousIPStruct: anonymous}, nil
+}
+
+// enrichAnonymousIP adds the anonymous IP fields to the city responses
+func (m *maxmind) enrichAnonymousIP(ctx context.Context, ip net.IP, resp *geoResponseStruct) error {
+	anonymous, err := m.anonymousIP(ctx, ip)
+	if err != nil {
+		return err
+	}
+	resp.anonymousIPStruct = anonymous
+	return nil
+}
+
+// torExitList is a list of Tor exit nodes, one IP per line (ex: https://check.torproject.org/torbulkexitlist), from
+// a URL or a file
+type torExitList struct {
+	mutex  sync.RWMutex
+	source string
+	// Of the database downloads, with their --download-timeout and --download-proxy
+	client *http.Client
+	ips    map[string]bool
+}
+
+func newTorExitList(source string, client *http.Client) (*torExitList, error) {
+	if source == "" {
+		return nil, nil
+	}
+
+	list := &torExitList{source: source, client: client}
+	return list, list.update()
+}
+
+// update reads the list again, the previous one is kept on errors
+func (l *torExitList) update() error {
+	var body io.ReadCloser
+	if strings.HasPrefix(l.source, "http://") || strings.HasPrefix(l.source, "https://") {
+		resp, err := l.client.Get(l.source)
+		if err != nil {
+			return fmt.Errorf("Tor exit list download failed: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("Tor exit list download failed with status %d", resp.StatusCode)
+		}
+		body = resp.Body
+	} else {
+		file, err := os.Open(l.source)
+		if err != nil {
+			return err
+		}
+		body = file
+	}
+	defer body.Close()
+
+	ips := map[string]bool{}
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if ip := net.ParseIP(line); ip != nil {
+			ips[ip.String()] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Tor exit list read failed: %w", err)
+	}
+
+	l.mutex.Lock()
+	l.ips = ips
+	l.mutex.Unlock()
+	log.Info().Msg(fmt.Sprintf("Loaded %d Tor exit nodes from '%s'", len(ips), l.source))
+	return nil
+}
+
+func (l *torExitList) contains(ip net.IP) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.ips[ip.String()]
+}
+
+// enrich flags the Tor exit nodes of the list, in addition to the ones of the Anonymous-IP edition
+func (l *torExitList) enrich(_ context.Context, ip net.IP, resp *geoResponseStruct) error {
+	if !l.contains(ip) {
+		return nil
+	}
+	if resp.anonymousIPStruct == nil {
+		resp.anonymousIPStruct = &anonymousIPStruct{}
+	}
+	resp.IsAnonymous = true
+	resp.IsTorExitNode = true
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// loadAPIKeys merges the keys with the ones of file, one per line, ignoring empty lines and "#" comments
+func loadAPIKeys(keys []string, file string) ([]string, error) {
+	if file == "" {
+		return keys, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+func isValidAPIKey(key string, keys []string) bool {
+	valid := false
+	for _, candidate := range keys {
+		// Compares every key in constant time, not to leak any through timing
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// requestAPIKey is the key in the X-API-Key header, an "Authorization: Bearer" header or the api_key query parameter
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// apiKeyMiddleware responds 401 to requests without one of the keys, when any is configured
+func apiKeyMiddleware(next httprouter.Handle, keys []string) httprouter.Handle {
+	if len(keys) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !isValidAPIKey(requestAPIKey(r), keys) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			errResponse(w, http.StatusUnauthorized, ERR_UNAUTHORIZED, "Missing or invalid API key")
+			return
+		}
+		next(w, r, ps)
+	}
+}
+
+// grpcAPIKeyInterceptors reject the calls without one of the keys in the "x-api-key" metadata, when any is configured
+func grpcAPIKeyInterceptors(keys []string) []grpc.ServerOption {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	check := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, key := range md.Get("x-api-key") {
+			if isValidAPIKey(key, keys) {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "Missing or invalid API key")
+	}
+
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := check(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := check(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"geoip-server/geoippb"
+	"github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// encodeMsgpack writes resp as MessagePack, with the same field names as the JSON
+func encodeMsgpack(w io.Writer, resp interface{}) error {
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	return encoder.Encode(resp)
+}
+
+// EncodeMsgpack writes the selected fields as a map, in the requested order
+func (s selectedFields) EncodeMsgpack(encoder *msgpack.Encoder) error {
+	if err := encoder.EncodeMapLen(len(s.names)); err != nil {
+		return err
+	}
+	for _, name := range s.names {
+		iter := jsoniter.ParseBytes(jsoniter.ConfigCompatibleWithStandardLibrary, s.values[name])
+		value := msgpackValue(iter)
+		if iter.Error != nil && iter.Error != io.EOF {
+			return iter.Error
+		}
+
+		if err := encoder.EncodeString(name); err != nil {
+			return err
+		}
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackValue reads a JSON value, keeping integers as integers: they would all be floats otherwise
+func msgpackValue(iter *jsoniter.Iterator) interface{} {
+	switch iter.WhatIsNext() {
+	case jsoniter.NumberValue:
+		number := iter.ReadNumber()
+		if i, err := number.Int64(); err == nil {
+			return i
+		}
+		f, _ := number.Float64()
+		return f
+	case jsoniter.ObjectValue:
+		object := map[string]interface{}{}
+		for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+			object[field] = msgpackValue(iter)
+		}
+		return object
+	case jsoniter.ArrayValue:
+		array := []interface{}{}
+		for iter.ReadArray() {
+			array = append(array, msgpackValue(iter))
+		}
+		return array
+	default:
+		return iter.Read()
+	}
+}
+
+// encodeProtobuf writes resp as a geoippb.LookupResponse, or a geoippb.LookupResponses for batches
+func encodeProtobuf(w io.Writer, resp interface{}) error {
+	var message proto.Message
+	if results, ok := resp.([]interface{}); ok {
+		responses := &geoippb.LookupResponses{}
+		for _, result := range results {
+			pbResp, err := protoResponse(result)
+			if err != nil {
+				return err
+			}
+			responses.Responses = append(responses.Responses, pbResp)
+		}
+		message = responses
+	} else {
+		pbResp, err := protoResponse(resp)
+		if err != nil {
+			return err
+		}
+		message = pbResp
+	}
+
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("protobuf encoding failed: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
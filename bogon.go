@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// bogonNetworks are the private, loopback, link-local and otherwise reserved ranges, which are not in the databases
+var bogonNetworks = parseNetworks(
+	// IPv4, RFC 6890
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.0.0.0/24",
+	"192.0.2.0/24", "192.168.0.0/16", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4",
+	"240.0.0.0/4",
+	// IPv6, the IPv4-mapped ones are matched as IPv4
+	"::/128", "::1/128", "100::/64", "2001:db8::/32", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+func isBogon(ip net.IP) bool {
+	for _, network := range bogonNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type bogonResponseStruct struct {
+	IP    string `json:"ip"`
+	Bogon bool   `json:"bogon"`
+}
+
+// bogonLookup answers the bogon IPs without looking them up: a {"ip", "bogon": true} response with status 200, or
+// else an error with that status (ex: 404 or 422)
+func bogonLookup(lookup lookupFunc, status int) lookupFunc {
+	return func(ctx context.Context, ipStr string, ip net.IP, langs []string) (interface{}, error) {
+		if !isBogon(ip) {
+			return lookup(ctx, ipStr, ip, langs)
+		}
+		if status == http.StatusOK {
+			return bogonResponseStruct{IP: ipStr, Bogon: true}, nil
+		}
+		return nil, lookupStatusError{status: status, code: ERR_BOGON_IP, message: "Bogon IP address"}
+	}
+}
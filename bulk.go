@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+)
+
+// bulkJob is an IP to look up, its response is sent to result
+type bulkJob struct {
+	ipStr  string
+	result chan interface{}
+}
+
+// bulkCommand looks up the IPs of a file (or stdin), one per line, with a pool of workers. The responses are written
+// to stdout in the order of the input, as NDJSON or CSV.
+func bulkCommand(args []string) {
+	var (
+		dbPaths []string
+		route   string
+		lang    string
+		format  string
+		fields  []string
+		workers int
+	)
+
+	flags := pflag.NewFlagSet("bulk", pflag.ExitOnError)
+	flags.StringSliceVarP(&dbPaths, "db", "d", []string{}, "Required: .mmdb file to look up in, can be repeated")
+	flags.StringVarP(&route, "route", "r", "", "Named lookup (ex: asn, country, full or an edition), the first database when empty")
+	flags.StringVar(&lang, "lang", DEFAULT_LANGUAGE, "Languages of the names, comma separated by preference")
+	flags.StringVarP(&format, "format", "f", "ndjson", "Output format: ndjson or csv")
+	flags.StringSliceVar(&fields, "fields", []string{}, "Fields to output, all of them when empty")
+	flags.IntVarP(&workers, "workers", "w", runtime.NumCPU(), "Number of concurrent lookups")
+	_ = flags.Parse(args)
+
+	if len(dbPaths) == 0 || flags.NArg() > 1 || format != "ndjson" && format != "csv" || workers < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: geoip-server bulk [file] --db file.mmdb, reads stdin without a file or with '-'\n%s", flags.FlagUsages())
+		os.Exit(2)
+	}
+
+	input := os.Stdin
+	if flags.NArg() == 1 && flags.Arg(0) != "-" {
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+		defer file.Close()
+		input = file
+	}
+
+	lookup := localLookup(dbPaths, route)
+	langs := splitLanguages(lang)
+
+	// The results are queued in the input order, so they are written in that order whichever worker finishes first
+	jobs := make(chan bulkJob, workers)
+	queue := make(chan chan interface{}, workers*16)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				job.result <- batchResult(context.Background(), lookup, job.ipStr, langs, fields)
+			}
+		}()
+	}
+
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+		scanner := bufio.NewScanner(input)
+		for scanner.Scan() {
+			ipStr := strings.TrimSpace(scanner.Text())
+			if ipStr == "" || strings.HasPrefix(ipStr, "#") {
+				continue
+			}
+			job := bulkJob{ipStr: ipStr, result: make(chan interface{}, 1)}
+			queue <- job.result
+			jobs <- job
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	output := bufio.NewWriter(os.Stdout)
+	var write func(resp interface{}) error
+	if format == "csv" {
+		write = csvRowWriter(output, fields)
+	} else {
+		write = func(resp interface{}) error {
+			if resp == nil {
+				return nil
+			}
+			if err := encodeJSON(output, resp); err != nil {
+				return err
+			}
+			return output.WriteByte('\n')
+		}
+	}
+
+	count := 0
+	for result := range queue {
+		if err := write(<-result); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+		count++
+	}
+	// Flushes the CSV rows
+	if err := write(nil); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	if err := output.Flush(); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	if err := <-scanErr; err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	log.Info().Msg(fmt.Sprintf("Looked up %d IPs", count))
+}
+
+// csvRowWriter returns a function writing each response as a CSV row, and flushing the rows on nil. The columns are
+// the fields when given, otherwise those of the first successful response (the earlier failures are held until then),
+// followed by an "error" column.
+func csvRowWriter(w io.Writer, fields []string) func(resp interface{}) error {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	writer := csv.NewWriter(w)
+	columns := fields
+	header := false
+	var pending []map[string]jsoniter.RawMessage
+
+	writeRow := func(row map[string]jsoniter.RawMessage) error {
+		record := make([]string, len(columns)+1)
+		for i, column := range columns {
+			record[i] = plainValue(row[column])
+		}
+		record[len(columns)] = plainValue(row["error"])
+		return writer.Write(record)
+	}
+	writeHeader := func() error {
+		header = true
+		if err := writer.Write(append(append([]string{}, columns...), "error")); err != nil {
+			return err
+		}
+		for _, row := range pending {
+			if err := writeRow(row); err != nil {
+				return err
+			}
+		}
+		pending = nil
+		return nil
+	}
+
+	return func(resp interface{}) error {
+		if resp == nil {
+			if !header {
+				if len(columns) == 0 {
+					columns = []string{"ip"}
+				}
+				if err := writeHeader(); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		row := map[string]jsoniter.RawMessage{}
+		var names []string
+		iter := jsoniter.ParseBytes(json, data)
+		for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+			row[field] = iter.SkipAndReturnBytes()
+			names = append(names, field)
+		}
+		if iter.Error != nil {
+			return iter.Error
+		}
+
+		if !header {
+			if _, failed := resp.(batchErrorStruct); failed && len(columns) == 0 {
+				pending = append(pending, row)
+				return nil
+			}
+			if len(columns) == 0 {
+				columns = names
+			}
+			if err := writeHeader(); err != nil {
+				return err
+			}
+		}
+		return writeRow(row)
+	}
+}
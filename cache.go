@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/hashicorp/golang-lru/v2"
+	"github.com/julienschmidt/httprouter"
+)
+
+// recordCache keeps the most recently decoded records of a reader. Each reader has its own, so swapping the
+// database invalidates it.
+type recordCache = lru.Cache[string, interface{}]
+
+type cacheStats struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheStatsStruct struct {
+	Edition  string `json:"edition"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+}
+
+func newRecordCache(size int) *recordCache {
+	if size <= 0 {
+		return nil
+	}
+	cache, _ := lru.New[string, interface{}](size)
+	return cache
+}
+
+// record returns the record of kind ("city", "asn"...) for ip, decoded by decode unless it is in the in-process
+// cache or else in Redis. Cached records are shared, they must not be modified.
+func (m *maxmind) record(ctx context.Context, kind string, ip net.IP, decode func(db *sharedReader) (interface{}, error)) (interface{}, error) {
+	db := m.acquire()
+	defer db.release()
+
+	if db.cache == nil && m.redis == nil {
+		return decode(db)
+	}
+
+	key := kind + "/" + ip.String()
+	if db.cache != nil {
+		if record, ok := db.cache.Get(key); ok {
+			m.cacheStats.hits.Add(1)
+			return record, nil
+		}
+		m.cacheStats.misses.Add(1)
+	}
+
+	if m.redis != nil {
+		if record := m.redis.get(ctx, m.edition, db.md5, kind, key); record != nil {
+			if db.cache != nil {
+				db.cache.Add(key, record)
+			}
+			return record, nil
+		}
+	}
+
+	record, err := decode(db)
+	if err != nil {
+		return nil, err
+	}
+	if db.cache != nil {
+		db.cache.Add(key, record)
+	}
+	if m.redis != nil {
+		m.redis.set(ctx, m.edition, db.md5, key, record)
+	}
+	return record, nil
+}
+
+func cacheStatsHandler(databases []*maxmind) httprouter.Handle {
+	return func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var resp []cacheStatsStruct
+		for _, m := range databases {
+			stats := cacheStatsStruct{
+				Edition: m.edition,
+				Hits:    m.cacheStats.hits.Load(),
+				Misses:  m.cacheStats.misses.Load(),
+			}
+			db := m.acquire()
+			if db.cache != nil {
+				stats.Size = db.cache.Len()
+				stats.Capacity = m.cacheSize
+			}
+			db.release()
+			resp = append(resp, stats)
+		}
+		geoResponse(w, resp)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"geoip-server/pkg/geoip"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+)
+
+// version is set at build time with: go build -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
+const USAGE string = `Usage: geoip-server <command> [flags]
+
+Commands:
+  serve    Serve the HTTP (and gRPC) API, the default when no command is given
+  lookup   Look up IPs in local .mmdb files: lookup 1.2.3.4 --db GeoLite2-City.mmdb
+  bulk     Look up the IPs of a file (one per line) as NDJSON or CSV: bulk ips.txt --db GeoLite2-City.mmdb
+  update   Download the editions to a directory: update --out dir --edition GeoLite2-City
+  rollback Roll a database of a directory back to a kept version: rollback --data-dir dir --edition GeoLite2-City
+  version  Print the version
+
+Run 'geoip-server <command> --help' for the flags of a command.
+`
+
+func main() {
+	// Without a command the flags are the serve ones, as before the subcommands existed
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		serve(os.Args[1:])
+		return
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "serve":
+		serve(args)
+	case "lookup":
+		lookupCommand(args)
+	case "bulk":
+		bulkCommand(args)
+	case "update":
+		updateCommand(args)
+	case "rollback":
+		rollbackCommand(args)
+	case "version":
+		fmt.Println(buildVersion())
+	case "help":
+		fmt.Print(USAGE)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'\n\n%s", command, USAGE)
+		os.Exit(2)
+	}
+}
+
+// buildVersion is the version set at build time, otherwise the module version from `go install`
+func buildVersion() string {
+	if version == "dev" {
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			return info.Main.Version
+		}
+	}
+	return version
+}
+
+// lookupCommand prints the JSON response of every IP argument, one per line, from local databases
+func lookupCommand(args []string) {
+	var (
+		dbPaths []string
+		route   string
+		lang    string
+	)
+
+	flags := pflag.NewFlagSet("lookup", pflag.ExitOnError)
+	flags.StringSliceVarP(&dbPaths, "db", "d", []string{}, "Required: .mmdb file to look up in, can be repeated")
+	flags.StringVarP(&route, "route", "r", "", "Named lookup (ex: asn, country, full or an edition), the first database when empty")
+	flags.StringVar(&lang, "lang", DEFAULT_LANGUAGE, "Languages of the names, comma separated by preference")
+	_ = flags.Parse(args)
+
+	if len(dbPaths) == 0 || flags.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: geoip-server lookup <ip>... --db file.mmdb\n%s", flags.FlagUsages())
+		os.Exit(2)
+	}
+
+	lookup := localLookup(dbPaths, route)
+	failed := false
+	for _, ipStr := range flags.Args() {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			fmt.Fprintf(os.Stderr, "%s: Invalid IP address\n", ipStr)
+			failed = true
+			continue
+		}
+
+		resp, err := lookup(context.Background(), ipStr, ip, splitLanguages(lang))
+		if err != nil {
+			_, _, message := lookupError(err)
+			fmt.Fprintf(os.Stderr, "%s: %s\n", ipStr, message)
+			failed = true
+			continue
+		}
+
+		data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(resp)
+		if err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+		fmt.Println(string(data))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// localLookup loads the .mmdb files and returns the named lookup, the one of the first database when route is empty
+func localLookup(dbPaths []string, route string) lookupFunc {
+	var databases []*maxmind
+	for _, path := range dbPaths {
+		databases = append(databases, &maxmind{path: path, notFound: NOT_FOUND_EMPTY})
+	}
+	if err := loadDatabases(databases, "", "", 0); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+
+	lookup, lookups := buildLookups(databases, nil, http.StatusOK)
+	if route != "" {
+		var ok bool
+		if lookup, ok = lookups[route]; !ok {
+			log.Fatal().Msg(fmt.Sprintf("Unknown route '%s'", route))
+		}
+	}
+	return lookup
+}
+
+// updateCommand downloads the editions to a directory, like geoipupdate, skipping the ones that did not change. The
+// downloads are verified before replacing the saved copies, exiting with 1 when one is not a database of its edition.
+func updateCommand(args []string) {
+	var (
+		outDir       string
+		editions     []string
+		accountId    string
+		license      string
+		licenseFile  string
+		secrets      string
+		keepVersions int
+	)
+
+	flags := pflag.NewFlagSet("update", pflag.ExitOnError)
+	flags.StringVarP(&outDir, "out", "o", ".", "Directory to save the <edition>.mmdb files to")
+	flags.StringSliceVarP(&editions, "edition", "e", []string{"GeoLite2-City"}, "edition of database to download, can be repeated")
+	flags.StringVarP(&accountId, "account-id", "a", "0", "Required: Sign up and generate this in the Maxmind website")
+	flags.StringVarP(&license, "license", "l", "", "Required: Sign up and generate this in the Maxmind website")
+	flags.StringVar(&licenseFile, "license-file", "", "File containing the license, ex: a Docker or Kubernetes secret, instead of --license")
+	flags.StringVar(&secrets, "secrets-source", "", "Secret manager to fetch the account ID and license from, ex: vault://secret/maxmind, aws-sm://<secret name or ARN> or gcp-sm://projects/<project>/secrets/<secret>")
+	flags.IntVar(&keepVersions, "keep-versions", 0, "Number of previous databases to keep in the directory, to roll back to")
+	downloadOptions := addDownloadFlags(flags)
+	_ = flags.Parse(args)
+	if err := applyEnv(flags); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	license, err := resolveLicense(license, licenseFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	creds, err := newMaxmindCredentials(accountId, license, secrets)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	accountId, license = creds.get()
+	downloader, err = downloadOptions.downloader()
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+
+	failed := false
+	for _, edition := range editions {
+		m := &maxmind{edition: edition, dataDir: outDir, keepVersions: keepVersions}
+		// The saved copy is only downloaded again when Maxmind has a different one
+		currentMD5 := ""
+		if current, err := geoip.FileMD5(m.cachePath()); err == nil {
+			currentMD5 = current
+		}
+
+		log.Info().Msg(fmt.Sprintf("Starting database download (edition: '%s')", edition))
+		db, err := m.download(context.Background(), accountId, license, currentMD5)
+		if errors.Is(err, geoip.ErrNotModified) {
+			log.Info().Msg(fmt.Sprintf("Database is up to date (edition: '%s')", edition))
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Msg(fmt.Sprintf("Fetching update failed (edition: '%s')", edition))
+			failed = true
+			continue
+		}
+		// Only saved, not looked up
+		db.opened.Close()
+		log.Info().Msg(fmt.Sprintf("Saved '%s'", m.cachePath()))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// rollbackCommand replaces a database of a data directory with a kept version (see --keep-versions), or lists them.
+// A server using the directory loads it on restart, or right away with POST /admin/rollback instead.
+func rollbackCommand(args []string) {
+	var (
+		dataDir string
+		edition string
+		build   uint
+		list    bool
+	)
+
+	flags := pflag.NewFlagSet("rollback", pflag.ExitOnError)
+	flags.StringVar(&dataDir, "data-dir", ".", "Directory of the databases, as given to serve or update")
+	flags.StringVarP(&edition, "edition", "e", "GeoLite2-City", "Edition of the database to roll back")
+	flags.UintVar(&build, "build", 0, "Build epoch of the version to roll back to (see --list), the previous one when 0")
+	flags.BoolVar(&list, "list", false, "List the kept versions instead, as JSON")
+	_ = flags.Parse(args)
+
+	m := &maxmind{edition: edition, dataDir: dataDir}
+	if list {
+		versions, err := m.versions()
+		if err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+		data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(versions)
+		if err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if _, err := m.rollback(build); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+}
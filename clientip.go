@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// clientIPResolver finds the IP of the client of a request, only honoring the forwarding headers when the
+// request comes from a trusted proxy, as anyone else could set them to spoof their location.
+// When header is set only that one is used, otherwise X-Real-IP, Forwarded and X-Forwarded-For in that order.
+type clientIPResolver struct {
+	trustedProxies []*net.IPNet
+	header         string
+}
+
+// newClientIPResolver parses the trusted proxies, as CIDRs or single IPs
+func newClientIPResolver(trustedProxies []string, header string) (*clientIPResolver, error) {
+	resolver := &clientIPResolver{header: http.CanonicalHeaderKey(header)}
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s': %w", proxy, err)
+		}
+		resolver.trustedProxies = append(resolver.trustedProxies, network)
+	}
+	return resolver, nil
+}
+
+func (c *clientIPResolver) isTrusted(ipStr string) bool {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range c.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *clientIPResolver) clientIP(request *http.Request) string {
+	peer, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		peer = request.RemoteAddr
+	}
+	// The clients of the unix socket are the local proxies allowed by its permissions
+	local, _ := request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !c.isTrusted(peer) && (local == nil || local.Network() != "unix") {
+		return peer
+	}
+
+	if c.header != "" {
+		var chain []string
+		if c.header == "Forwarded" {
+			chain = forwardedFor(request.Header.Values(c.header))
+		} else {
+			chain = splitList(request.Header.Values(c.header))
+		}
+		if len(chain) > 0 {
+			return c.chainClient(chain)
+		}
+		return peer
+	}
+
+	if ip := strings.TrimSpace(request.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+
+	if chain := forwardedFor(request.Header.Values("Forwarded")); len(chain) > 0 {
+		return c.chainClient(chain)
+	}
+
+	if chain := splitList(request.Header.Values("X-Forwarded-For")); len(chain) > 0 {
+		return c.chainClient(chain)
+	}
+
+	return peer
+}
+
+// chainClient returns the client of a forwarding chain. Each proxy appends the address it got the request
+// from, "client, proxy1, proxy2", so walking from the right the first address not of a trusted proxy is the client.
+func (c *clientIPResolver) chainClient(chain []string) string {
+	for i := len(chain) - 1; i > 0; i-- {
+		if !c.isTrusted(chain[i]) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
+// splitList splits comma separated header values, dropping the empty items
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// forwardedFor returns the "for" addresses of RFC 7239 Forwarded headers, ex:
+// `for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"`.
+// Ports and IPv6 brackets are removed, "unknown" and obfuscated identifiers are kept as is.
+func forwardedFor(values []string) []string {
+	var addresses []string
+	for _, element := range splitList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(key), "for") {
+				continue
+			}
+			addresses = append(addresses, forwardedNode(strings.Trim(strings.TrimSpace(value), `"`)))
+		}
+	}
+	return addresses
+}
+
+// forwardedNode strips the port and brackets of a Forwarded node: "[2001:db8::1]:4711" -> "2001:db8::1"
+func forwardedNode(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return node
+}
+
+type ipResponseStruct struct {
+	IP string `json:"ip"`
+}
+
+// ipHandler echoes the client IP, as text unless JSON is asked for with ?format=json or the Accept header
+func ipHandler(resolver *clientIPResolver) httprouter.Handle {
+	return func(w http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+		ip := resolver.clientIP(request)
+
+		format, err := requestFormat(request)
+		explicit := request.URL.Query().Get("format") != "" || strings.Contains(request.Header.Get("Accept"), "application/json")
+		if err != nil || format != "json" || explicit {
+			formatResponse(w, request, ipResponseStruct{IP: ip})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := io.WriteString(w, ip+"\n"); err != nil {
+			log.Error().Err(err).Msg("")
+		}
+	}
+}
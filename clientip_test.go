@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	unix := &net.UnixAddr{Name: "/run/geoip.sock", Net: "unix"}
+	tests := []struct {
+		name       string
+		trusted    []string
+		header     string
+		remoteAddr string
+		local      net.Addr
+		headers    map[string]string
+		expected   string
+	}{
+		{"untrusted peer", []string{"10.0.0.0/8"}, "", "203.0.113.9:4711", nil,
+			map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"}, "203.0.113.9"},
+		{"no proxies", nil, "", "203.0.113.9:4711", nil, nil, "203.0.113.9"},
+		{"trusted multi-hop", []string{"10.0.0.0/8"}, "", "10.0.0.1:4711", nil,
+			map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"trusted multiple headers", []string{"10.0.0.0/8"}, "", "10.0.0.1:4711", nil,
+			map[string]string{"X-Forwarded-For": "198.51.100.7,,10.0.0.2 "}, "198.51.100.7"},
+		{"all trusted", []string{"10.0.0.0/8", "192.0.2.1"}, "", "10.0.0.1:4711", nil,
+			map[string]string{"X-Forwarded-For": "10.0.0.5, 192.0.2.1, 10.0.0.2"}, "10.0.0.5"},
+		{"trusted without header", []string{"10.0.0.1"}, "", "10.0.0.1:4711", nil, nil, "10.0.0.1"},
+		{"x-real-ip first", []string{"10.0.0.0/8"}, "", "10.0.0.1:4711", nil,
+			map[string]string{"X-Real-IP": "198.51.100.7", "X-Forwarded-For": "1.2.3.4"}, "198.51.100.7"},
+		{"forwarded before x-forwarded-for", []string{"10.0.0.0/8"}, "", "10.0.0.1:4711", nil,
+			map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "1.2.3.4"}, "198.51.100.7"},
+		{"forwarded quoted ipv6 with port", []string{"10.0.0.0/8"}, "", "10.0.0.1:4711", nil,
+			map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.2`}, "2001:db8:cafe::17"},
+		{"forwarded unknown", []string{"10.0.0.0/8"}, "", "10.0.0.1:4711", nil,
+			map[string]string{"Forwarded": "for=unknown;by=10.0.0.1"}, "unknown"},
+		{"forwarded unknown hop", []string{"10.0.0.0/8"}, "", "10.0.0.1:4711", nil,
+			map[string]string{"Forwarded": "for=198.51.100.7, for=unknown, for=10.0.0.2"}, "unknown"},
+		{"header override", []string{"10.0.0.0/8"}, "cf-connecting-ip", "10.0.0.1:4711", nil,
+			map[string]string{"CF-Connecting-IP": "198.51.100.7", "X-Real-IP": "1.2.3.4"}, "198.51.100.7"},
+		{"header override missing", []string{"10.0.0.0/8"}, "CF-Connecting-IP", "10.0.0.1:4711", nil,
+			map[string]string{"X-Real-IP": "1.2.3.4"}, "10.0.0.1"},
+		{"header override forwarded", []string{"10.0.0.0/8"}, "Forwarded", "10.0.0.1:4711", nil,
+			map[string]string{"Forwarded": `for="198.51.100.7:80"`, "X-Real-IP": "1.2.3.4"}, "198.51.100.7"},
+		{"header override untrusted", []string{"10.0.0.0/8"}, "CF-Connecting-IP", "203.0.113.9:4711", nil,
+			map[string]string{"CF-Connecting-IP": "198.51.100.7"}, "203.0.113.9"},
+		{"unix socket", nil, "", "@", unix,
+			map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"unix socket without header", nil, "", "@", unix, nil, "@"},
+	}
+	for _, test := range tests {
+		resolver, err := newClientIPResolver(test.trusted, test.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = test.remoteAddr
+		if test.local != nil {
+			request = request.WithContext(context.WithValue(request.Context(), http.LocalAddrContextKey, test.local))
+		}
+		for key, value := range test.headers {
+			request.Header.Set(key, value)
+		}
+		if ip := resolver.clientIP(request); ip != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.name, ip, test.expected)
+		}
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	tests := []struct {
+		values   []string
+		expected []string
+	}{
+		{[]string{"for=192.0.2.60;proto=http;by=203.0.113.43"}, []string{"192.0.2.60"}},
+		{[]string{`For="[2001:db8:cafe::17]:4711"`}, []string{"2001:db8:cafe::17"}},
+		{[]string{`for="[2001:db8:cafe::17]"`, "for=192.0.2.43:80"}, []string{"2001:db8:cafe::17", "192.0.2.43"}},
+		{[]string{"for=unknown, for=_hidden"}, []string{"unknown", "_hidden"}},
+		{[]string{"proto=https;by=203.0.113.43"}, nil},
+	}
+	for _, test := range tests {
+		if addresses := forwardedFor(test.values); strings.Join(addresses, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%v: got %v, expected %v", test.values, addresses, test.expected)
+		}
+	}
+}
+
+func TestNewClientIPResolver(t *testing.T) {
+	if _, err := newClientIPResolver([]string{"10.0.0.0/33"}, ""); err == nil {
+		t.Error("expected an error for an invalid CIDR")
+	}
+	if _, err := newClientIPResolver([]string{"proxy.local"}, ""); err == nil {
+		t.Error("expected an error for a hostname")
+	}
+	resolver, err := newClientIPResolver([]string{"192.0.2.1", "2001:db8::1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resolver.isTrusted("192.0.2.1") || resolver.isTrusted("192.0.2.2") || !resolver.isTrusted("2001:db8::1") {
+		t.Error("expected the single IPs to be trusted alone")
+	}
+}
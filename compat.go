@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// compatAPI is the API of another geolocation service, served with --compat for its clients to switch to this server
+// with only a DNS (or base URL) change
+type compatAPI struct {
+	// register adds the routes of the API under prefix, ex: /json/:ip
+	register func(router *httprouter.Router, prefix string, c *compatContext)
+	// root, when set, serves the paths under the prefix not matching any route (ex: /8.8.8.8), as httprouter can't
+	// register a wildcard next to the static segments of the other routes
+	root func(prefix string, c *compatContext) httprouter.Handle
+}
+
+// compatAPIs by --compat name
+var compatAPIs = map[string]compatAPI{
+	"freegeoip": {register: freegeoipRoutes},
+	"ip-api":    {register: ipapiRoutes},
+	"ipinfo":    {root: ipinfoRoot},
+	"ipstack":   {root: ipstackRoot},
+	"maxmind":   {register: webServiceRoutes},
+}
+
+// compatContext is what the compat APIs look up with
+type compatContext struct {
+	// The lookup of a City edition, merged with the ASN one when loaded
+	lookup lookupFunc
+	// The City edition, for the APIs serving its records as is
+	city *maxmind
+	// The lookup of the ASN edition, nil when not loaded
+	asn       lookupFunc
+	resolver  *clientIPResolver
+	hostnames *hostnameResolver
+	// The --api-keys, for the APIs with their own authentication errors
+	apiKeys []string
+	// Wraps the handlers like the API routes: authentication, metrics, CORS and compression
+	apiRoute func(route string, handle httprouter.Handle) httprouter.Handle
+}
+
+// parseCompat returns the route prefixes of the --compat values, "<name>" or "<name>=<prefix>" (ex:
+// ipstack=/ipstack), by name
+func parseCompat(values []string) (map[string]string, error) {
+	prefixes := map[string]string{}
+	for _, value := range values {
+		name, prefix, _ := strings.Cut(value, "=")
+		if _, ok := compatAPIs[name]; !ok {
+			names := make([]string, 0, len(compatAPIs))
+			for name := range compatAPIs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown --compat API '%s', expected one of %s", name, strings.Join(names, ", "))
+		}
+		if prefix != "" && (!strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/")) {
+			return nil, fmt.Errorf("invalid --compat prefix '%s', expected a path like /%s", prefix, name)
+		}
+		prefixes[name] = prefix
+	}
+	return prefixes, nil
+}
+
+// compatCity returns the first City edition and the lookup the compat APIs serve it with: the full lookup adding the
+// ASN edition when both are loaded, otherwise the one of the edition. Both are nil without a City edition.
+func compatCity(databases []*maxmind, lookups map[string]lookupFunc) (*maxmind, lookupFunc) {
+	for _, m := range databases {
+		if !m.isCity() {
+			continue
+		}
+		if full, ok := lookups["full"]; ok {
+			return m, full
+		}
+		return m, lookups[m.edition]
+	}
+	return nil, nil
+}
+
+// compatRouter returns the router of the compat APIs, served for the requests not matching the routes of the server.
+// The APIs sharing a prefix must not have the same routes.
+func compatRouter(prefixes map[string]string, c *compatContext) (router *httprouter.Router, err error) {
+	router = newRouter()
+	// httprouter panics on the conflicting routes
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("the --compat routes conflict, give one of the APIs another prefix (ex: ipstack=/ipstack): %v", recovered)
+		}
+	}()
+
+	names := make([]string, 0, len(prefixes))
+	for name := range prefixes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	roots := map[string]string{}
+	for _, name := range names {
+		api, prefix := compatAPIs[name], prefixes[name]
+		if api.register != nil {
+			api.register(router, prefix, c)
+		}
+		if api.root != nil {
+			if other, ok := roots[prefix]; ok {
+				return nil, fmt.Errorf("--compat %s and %s both serve the paths under '%s/', give one of them another prefix", other, name, prefix)
+			}
+			roots[prefix] = name
+			if prefix == "" {
+				router.NotFound = handleToHandler(api.root(prefix, c))
+			} else {
+				router.GET(prefix+"/*path", api.root(prefix, c))
+			}
+		}
+		log.Info().Msg(fmt.Sprintf("Serving the %s compatible API under '%s/'", name, prefix))
+	}
+	return router, nil
+}
+
+// handleToHandler serves a handle without route parameters
+func handleToHandler(handle httprouter.Handle) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w, r, nil)
+	})
+}
+
+// queryAPIKey takes the param query parameter as the API key, when there is no X-API-Key header, for the APIs with
+// their own parameter (ex: ?access_key=)
+func queryAPIKey(param string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if key := r.URL.Query().Get(param); key != "" && r.Header.Get("X-API-Key") == "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		next(w, r, ps)
+	}
+}
+
+// lookupCity looks up the IP of the "ip" parameter (or the client IP when empty) in the City edition, writing the
+// error response on failure. The bogons have an empty response.
+func (c *compatContext) lookupCity(w http.ResponseWriter, request *http.Request, ps httprouter.Params) (geoResponseStruct, bool) {
+	ipStr, resp, ok := c.lookupRecord(w, request, ps)
+	if !ok {
+		return geoResponseStruct{}, false
+	}
+	geo, ok := resp.(geoResponseStruct)
+	if !ok {
+		geo = geoResponseStruct{IP: ipStr}
+	}
+	return geo, true
+}
+
+// lookupRecord is lookupCity returning the response of the lookup as is, a geoResponseStruct or bogonResponseStruct
+func (c *compatContext) lookupRecord(w http.ResponseWriter, request *http.Request, ps httprouter.Params) (string, interface{}, bool) {
+	ipStr, ip, _ := requestIP(w, request, ps, c.resolver, c.hostnames)
+	if ip == nil {
+		return ipStr, nil, false
+	}
+	log.Info().Msg(fmt.Sprintf("Looking up IP '%s'", logIP(ipStr)))
+
+	resp, err := c.lookup(request.Context(), ipStr, ip, requestLanguages(request))
+	if err != nil {
+		status, code, message := lookupError(err)
+		errResponse(w, status, code, message)
+		return ipStr, nil, false
+	}
+	return ipStr, resp, true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// TestCompatRouterCity serves the compat APIs with the City test database alone, the default setup without the full
+// lookup
+func TestCompatRouterCity(t *testing.T) {
+	databases := []*maxmind{testCityDatabase(t, NOT_FOUND_EMPTY)}
+	_, lookups := buildLookups(databases, nil, http.StatusOK)
+	cityDB, cityLookup := compatCity(databases, lookups)
+	if cityDB == nil || cityLookup == nil {
+		t.Fatal("expected the lookup of the City edition")
+	}
+
+	prefixes, err := parseCompat([]string{"freegeoip", "ipinfo=/ipinfo", "ip-api=/ipapi", "ipstack=/ipstack", "maxmind"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := newClientIPResolver(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := compatRouter(prefixes, &compatContext{
+		lookup:   cityLookup,
+		city:     cityDB,
+		asn:      lookups["asn"],
+		resolver: resolver,
+		apiRoute: func(_ string, handle httprouter.Handle) httprouter.Handle { return handle },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"/json/216.160.83.56",
+		"/ipinfo/216.160.83.56/json",
+		"/ipapi/json/216.160.83.56",
+		"/ipstack/216.160.83.56",
+		"/geoip/v2.1/city/216.160.83.56",
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, expected 200: %s", path, recorder.Code, recorder.Body.String())
+			continue
+		}
+		if !strings.Contains(recorder.Body.String(), "Milton") {
+			t.Errorf("%s: expected the city in %s", path, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// gzipWriter holds the response until it reaches minSize, then writes it gzipped. Smaller ones are written as is
+// once the handler is done, as compressing them would not save anything.
+type gzipWriter struct {
+	http.ResponseWriter
+	minSize    int
+	statusCode int
+	buf        bytes.Buffer
+	gzip       *gzip.Writer
+	// Set once the decision to compress or not is made
+	decided bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if w.statusCode == 0 {
+		w.statusCode = code
+	}
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.decided {
+		if w.gzip != nil {
+			return w.gzip.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf.Write(b)
+	if w.buf.Len() >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start writes the header and the held response, gzipped when compress is set and the response is not encoded yet
+func (w *gzipWriter) start(compress bool) error {
+	w.decided = true
+	if w.Header().Get("Content-Encoding") != "" || w.statusCode == http.StatusNoContent || w.statusCode == http.StatusNotModified {
+		compress = false
+	}
+
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gzip = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.gzip != nil {
+		_, err = w.gzip.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// close writes what is held, or finishes the gzip stream
+func (w *gzipWriter) close() error {
+	if !w.decided {
+		if w.statusCode == 0 {
+			w.statusCode = http.StatusOK
+		}
+		return w.start(false)
+	}
+	if w.gzip != nil {
+		return w.gzip.Close()
+	}
+	return nil
+}
+
+// acceptsGzip reports whether the Accept-Encoding of the request allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range acceptList(r.Header.Get("Accept-Encoding")) {
+		if strings.EqualFold(encoding, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// compressionMiddleware gzips the responses of at least minSize bytes to the clients accepting it, disabled when
+// minSize is 0. It must wrap the middlewares changing the body or its Content-Type (ex: JSONP).
+func compressionMiddleware(next httprouter.Handle, minSize int) httprouter.Handle {
+	if minSize <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next(w, r, ps)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w, minSize: minSize}
+		next(gw, r, ps)
+		_ = gw.close()
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const ENV_PREFIX string = "GEOIP_"
+
+// ENV_FILE_SUFFIX names the environment variables holding the path of a file with the value of a flag, like the
+// Docker secrets convention, ex: GEOIP_LICENSE_FILE=/run/secrets/maxmind_license
+const ENV_FILE_SUFFIX string = "_FILE"
+
+// envName returns the environment variable backing a flag, ex: "account-id" -> "GEOIP_ACCOUNT_ID"
+func envName(flagName string) string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag that was not given on the command line from its environment variable, or the file of its
+// _FILE one, so the precedence is: flags > environment variables > defaults
+func applyEnv(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed {
+			return
+		}
+		value, ok := os.LookupEnv(envName(flag.Name))
+		// Unless the flag has its own -file one (ex: --license-file), read from the same variable
+		if path, fileOk := os.LookupEnv(envName(flag.Name) + ENV_FILE_SUFFIX); fileOk && flags.Lookup(flag.Name+"-file") == nil {
+			if ok {
+				err = fmt.Errorf("both %s and %s are set", envName(flag.Name), envName(flag.Name)+ENV_FILE_SUFFIX)
+				return
+			}
+			if value, err = readSecretFile(path); err != nil {
+				err = fmt.Errorf("reading %s: %w", envName(flag.Name)+ENV_FILE_SUFFIX, err)
+				return
+			}
+			ok = true
+		}
+		if !ok {
+			return
+		}
+		if setErr := flags.Set(flag.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %w", envName(flag.Name), setErr)
+		}
+	})
+	return err
+}
+
+// readSecretFile returns the content of a file holding a secret (ex: a Docker or Kubernetes secret mount), without
+// the trailing newline
+func readSecretFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// resolveLicense returns the license, or the content of the licenseFile, given at most one of them
+func resolveLicense(license string, licenseFile string) (string, error) {
+	if licenseFile == "" {
+		return license, nil
+	}
+	if license != "" {
+		return "", fmt.Errorf("both --license and --license-file are set")
+	}
+	license, err := readSecretFile(licenseFile)
+	if err != nil {
+		return "", fmt.Errorf("reading the license file: %w", err)
+	}
+	if license == "" {
+		return "", fmt.Errorf("the license file '%s' is empty", licenseFile)
+	}
+	return license, nil
+}
+
+// applyConfigFile sets every flag that was not given on the command line nor the environment from
+// a YAML or TOML file whose keys are the flag names, so the precedence is: flags > environment
+// variables > config file > defaults
+func applyConfigFile(flags *pflag.FlagSet, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	default:
+		return fmt.Errorf("unsupported config file format: '%s' (expected .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file '%s': %w", path, err)
+	}
+
+	for name, value := range values {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("unknown option in config file '%s': '%s'", path, name)
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := flags.Set(name, configValueString(value)); err != nil {
+			return fmt.Errorf("invalid value for '%s' in config file '%s': %w", name, path, err)
+		}
+	}
+	return nil
+}
+
+// configValueString converts a decoded config value to its flag representation, lists are comma separated
+func configValueString(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Request headers allowed for the CORS requests, and how long (in seconds) browsers may cache the preflight responses
+const (
+	CORS_ALLOWED_HEADERS string = "Accept, Accept-Language, Authorization, Content-Type, If-None-Match, X-API-Key"
+	CORS_MAX_AGE         int    = 86400
+)
+
+// originMatcher tells whether an origin is allowed by --allowed-origins: "*" for any, exact origins, wildcard
+// subdomains (ex: "https://*.example.com") or regular expressions prefixed with "~", matching the whole origin
+// (ex: "~https://app-[0-9]+\.example\.com").
+// The "null" origin, of sandboxed iframes and local files, is only allowed when listed as is.
+type originMatcher struct {
+	any      bool
+	exact    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func newOriginMatcher(allowedOrigins []string) (*originMatcher, error) {
+	matcher := &originMatcher{exact: map[string]bool{}}
+	for _, origin := range allowedOrigins {
+		switch {
+		case origin == "*":
+			matcher.any = true
+		case strings.HasPrefix(origin, "~"):
+			// Anchored, as "~https://app\.example\.com" would otherwise allow https://app.example.com.evil.net
+			pattern, err := regexp.Compile("^(?:" + origin[1:] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed origin pattern '%s': %w", origin, err)
+			}
+			matcher.patterns = append(matcher.patterns, pattern)
+		case strings.Contains(origin, "*."):
+			// Any number of subdomain levels, but not the domain itself
+			parts := strings.SplitN(origin, "*.", 2)
+			pattern := "^" + regexp.QuoteMeta(parts[0]) + `([a-zA-Z0-9-]+\.)+` + regexp.QuoteMeta(parts[1]) + "$"
+			matcher.patterns = append(matcher.patterns, regexp.MustCompile(pattern))
+		default:
+			matcher.exact[origin] = true
+		}
+	}
+	return matcher, nil
+}
+
+func (m *originMatcher) allows(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if m.exact[origin] {
+		return true
+	}
+	if origin == "null" {
+		return false
+	}
+	if m.any {
+		return true
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsPolicy sets the CORS headers of the responses to the allowed origins
+type corsPolicy struct {
+	*originMatcher
+	allowCredentials bool
+	exposeHeaders    []string
+	// Whether to add Vary: Origin, as the Access-Control-Allow-Origin of the responses is their origin
+	varyOrigin bool
+}
+
+// allowOrigin sets the headers common to the responses and preflight responses, reporting whether the origin is allowed
+func (c *corsPolicy) allowOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if c.varyOrigin {
+		w.Header().Add("Vary", "Origin")
+	}
+	origin := r.Header.Get("Origin")
+	if !c.allows(origin) {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.allowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// preflightHandler answers the CORS preflight requests of the allowed origins, sent by browsers before the requests
+// with headers or methods not allowed by default (ex: X-API-Key, or a POST of JSON)
+func preflightHandler(cors *corsPolicy, methods string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if r.Header.Get("Access-Control-Request-Method") != "" && cors.allowOrigin(w, r) {
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", CORS_ALLOWED_HEADERS)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(CORS_MAX_AGE))
+		}
+		w.Header().Set("Allow", methods)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestOriginMatcher(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		origin  string
+		allows  bool
+	}{
+		{[]string{"https://example.com"}, "https://example.com", true},
+		{[]string{"https://example.com"}, "https://example.com:8443", false},
+		{[]string{"https://example.com"}, "", false},
+		{[]string{"*"}, "https://anything.test", true},
+		{[]string{"*"}, "", false},
+		{[]string{"https://*.example.com"}, "https://app.example.com", true},
+		{[]string{"https://*.example.com"}, "https://a.b.example.com", true},
+		{[]string{"https://*.example.com"}, "https://example.com", false},
+		{[]string{"https://*.example.com"}, "https://evil-example.com", false},
+		{[]string{"https://*.example.com"}, "https://app.example.com.evil.net", false},
+		{[]string{"https://*.example.com"}, "https://evil.net/.example.com", false},
+		{[]string{"https://*.example.com"}, "http://app.example.com", false},
+		{[]string{`~https://app-[0-9]+\.example\.com`}, "https://app-12.example.com", true},
+		{[]string{`~https://app-[0-9]+\.example\.com`}, "https://app-12.example.com.evil.net", false},
+		{[]string{`~https://app-[0-9]+\.example\.com`}, "https://evil.net?https://app-1.example.com", false},
+		{[]string{`~^https://app\.example\.com$`}, "https://app.example.com", true},
+		{[]string{`~https://a\.example\.com|https://b\.example\.com`}, "https://b.example.com", true},
+		{[]string{`~https://a\.example\.com|https://b\.example\.com`}, "https://a.example.com.evil.net", false},
+		{[]string{"*"}, "null", false},
+		{[]string{"~.*"}, "null", false},
+		{[]string{"null"}, "null", true},
+	}
+	for _, test := range tests {
+		matcher, err := newOriginMatcher(test.allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allows := matcher.allows(test.origin); allows != test.allows {
+			t.Errorf("%v: got %t for '%s', expected %t", test.allowed, allows, test.origin, test.allows)
+		}
+	}
+
+	if _, err := newOriginMatcher([]string{"~https://(example.com"}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestPreflightHandler(t *testing.T) {
+	origins, err := newOriginMatcher([]string{"https://*.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle := preflightHandler(&corsPolicy{originMatcher: origins, varyOrigin: true}, "GET, POST, OPTIONS")
+
+	for _, test := range []struct {
+		origin string
+		allows bool
+	}{
+		{"https://app.example.com", true},
+		{"https://evil-example.com", false},
+		{"null", false},
+	} {
+		request := httptest.NewRequest(http.MethodOptions, "/geoip/batch", nil)
+		request.Header.Set("Origin", test.origin)
+		request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		recorder := httptest.NewRecorder()
+		handle(recorder, request, nil)
+
+		if recorder.Code != http.StatusNoContent {
+			t.Errorf("%s: got status %d, expected 204", test.origin, recorder.Code)
+		}
+		allowOrigin := recorder.Header().Get("Access-Control-Allow-Origin")
+		if test.allows && (allowOrigin != test.origin || recorder.Header().Get("Access-Control-Allow-Methods") != "GET, POST, OPTIONS") {
+			t.Errorf("%s: expected the origin to be allowed, got %v", test.origin, recorder.Header())
+		}
+		if !test.allows && (allowOrigin != "" || recorder.Header().Get("Access-Control-Allow-Methods") != "") {
+			t.Errorf("%s: expected the origin to be refused, got %v", test.origin, recorder.Header())
+		}
+		if recorder.Header().Get("Vary") != "Origin" {
+			t.Errorf("%s: expected Vary: Origin, got %v", test.origin, recorder.Header())
+		}
+	}
+}
+
+func TestHeadersMiddlewareMethods(t *testing.T) {
+	origins, err := newOriginMatcher([]string{"https://app.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle := headersMiddleware(func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {}, &corsPolicy{originMatcher: origins}, "GET, POST, OPTIONS")
+
+	request := httptest.NewRequest(http.MethodPost, "/geoip/batch", nil)
+	request.Header.Set("Origin", "https://app.example.com")
+	recorder := httptest.NewRecorder()
+	handle(recorder, request, nil)
+	if methods := recorder.Header().Get("Access-Control-Allow-Methods"); methods != "GET, POST, OPTIONS" {
+		t.Errorf("got the methods '%s', expected 'GET, POST, OPTIONS'", methods)
+	}
+	if origin := recorder.Header().Get("Access-Control-Allow-Origin"); origin != "https://app.example.com" {
+		t.Errorf("got the origin '%s', expected https://app.example.com", origin)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/json-iterator/go"
+)
+
+// encodeCSV writes a header and a row per response (one, or one per IP for batches), from their JSON representation.
+// The columns are every field in order of appearance, nested values are kept as JSON.
+func encodeCSV(w io.Writer, resp interface{}) error {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	var rows []map[string]jsoniter.RawMessage
+	var columns []string
+	seen := map[string]bool{}
+	readRow := func(iter *jsoniter.Iterator) {
+		row := map[string]jsoniter.RawMessage{}
+		for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+			row[field] = iter.SkipAndReturnBytes()
+			if !seen[field] {
+				seen[field] = true
+				columns = append(columns, field)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	iter := jsoniter.ParseBytes(json, data)
+	if iter.WhatIsNext() == jsoniter.ArrayValue {
+		for iter.ReadArray() {
+			readRow(iter)
+		}
+	} else {
+		readRow(iter)
+	}
+	if iter.Error != nil {
+		return iter.Error
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = plainValue(row[column])
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
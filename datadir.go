@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"geoip-server/pkg/geoip"
+	"github.com/rs/zerolog/log"
+)
+
+// cachePath is where the downloaded edition is persisted, when a data directory is configured
+func (m *maxmind) cachePath() string {
+	return filepath.Join(m.dataDir, m.edition+".mmdb")
+}
+
+// download streams the edition to a temporary file of the data directory, renamed over the persisted copy once it is
+// complete, synced and checked, so an interrupted or corrupt download never replaces a good copy. The database stays
+// open for reload to swap it in. Without a data directory the temporary file is in the system one, checked when
+// reloaded.
+func (m *maxmind) download(ctx context.Context, accountId string, license string, currentMD5 string) (*fetchedDatabase, error) {
+	if m.dataDir != "" {
+		if err := os.MkdirAll(m.dataDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	path, sum, err := downloader.DownloadFile(ctx, m.edition, accountId, license, currentMD5, m.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if m.dataDir == "" {
+		return &fetchedDatabase{path: path, temporary: true, md5: sum}, nil
+	}
+	// Until Maxmind releases another one than the databases rolled back from
+	if m.skipped(sum) {
+		os.Remove(path)
+		log.Info().Msg(fmt.Sprintf("Skipping the database rolled back from (edition: '%s', md5: '%s')", m.edition, sum))
+		return nil, geoip.ErrNotModified
+	}
+	// The checksums only cover the transfer, not a truncated or wrong edition download
+	opened, err := geoip.OpenFile(path, m.edition)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	if err := m.keepVersion(); err != nil {
+		log.Error().Err(err).Msg(fmt.Sprintf("Keeping the previous database failed (edition: '%s')", m.edition))
+	}
+	// The mapping follows the file
+	if err := os.Rename(path, m.cachePath()); err != nil {
+		opened.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return &fetchedDatabase{path: m.cachePath(), md5: sum, opened: opened}, nil
+}
+
+// fetchAtStartup returns the persisted copy of the edition when it is younger than maxAge, otherwise fetches it.
+// When fetching fails the persisted copy is used regardless of its age.
+func (m *maxmind) fetchAtStartup(ctx context.Context, accountId string, license string, maxAge time.Duration) (*fetchedDatabase, error) {
+	if m.path != "" || m.dataDir == "" {
+		return m.fetch(ctx, accountId, license)
+	}
+
+	info, statErr := os.Stat(m.cachePath())
+	if statErr == nil && time.Since(info.ModTime()) < maxAge {
+		log.Info().Msg(fmt.Sprintf("Reading cached database from '%s'", m.cachePath()))
+		return readDatabase(m.cachePath())
+	}
+
+	db, err := m.fetch(ctx, accountId, license)
+	if err != nil && statErr == nil {
+		// Not modified when the download is the database rolled back from
+		if !errors.Is(err, geoip.ErrNotModified) {
+			log.Error().Err(err).Msg(fmt.Sprintf("Download failed, falling back to the cached database '%s'", m.cachePath()))
+		}
+		return readDatabase(m.cachePath())
+	}
+	return db, err
+}
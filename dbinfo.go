@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+type databaseInfoStruct struct {
+	Edition   string    `json:"edition"`
+	BuildTime time.Time `json:"build_time"`
+	// Seconds since the epoch, as in the database metadata
+	BuildEpoch          uint              `json:"build_epoch"`
+	Description         map[string]string `json:"description"`
+	BinaryFormatVersion string            `json:"binary_format_version"`
+	IPVersion           uint              `json:"ip_version"`
+	NodeCount           uint              `json:"node_count"`
+	RecordSize          uint              `json:"record_size"`
+	Languages           []string          `json:"languages"`
+	MD5                 string            `json:"md5"`
+	// Time of the last successful update, or check finding it up to date
+	LastUpdate time.Time `json:"last_update"`
+	// Previous databases that can be rolled back to, see --keep-versions
+	Versions []databaseVersionStruct `json:"versions,omitempty"`
+}
+
+// info returns the metadata of the loaded database
+func (m *maxmind) info() databaseInfoStruct {
+	db := m.acquire()
+	defer db.release()
+	metadata := db.Metadata()
+
+	m.mutex.RLock()
+	lastUpdate := m.lastSuccess
+	m.mutex.RUnlock()
+
+	versions, err := m.versions()
+	if err != nil {
+		log.Error().Err(err).Msg(fmt.Sprintf("Listing the database versions failed (edition: '%s')", m.edition))
+	}
+
+	return databaseInfoStruct{
+		Edition:             m.edition,
+		BuildTime:           time.Unix(int64(metadata.BuildEpoch), 0).UTC(),
+		BuildEpoch:          metadata.BuildEpoch,
+		Description:         metadata.Description,
+		BinaryFormatVersion: fmt.Sprintf("%d.%d", metadata.BinaryFormatMajorVersion, metadata.BinaryFormatMinorVersion),
+		IPVersion:           metadata.IPVersion,
+		NodeCount:           metadata.NodeCount,
+		RecordSize:          metadata.RecordSize,
+		Languages:           metadata.Languages,
+		MD5:                 db.md5,
+		LastUpdate:          lastUpdate,
+		Versions:            versions,
+	}
+}
+
+// dbInfoHandler responds with the metadata of every loaded database, to tell which version a replica serves
+func dbInfoHandler(databases []*maxmind) httprouter.Handle {
+	return func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		resp := make([]databaseInfoStruct, len(databases))
+		for i, m := range databases {
+			resp[i] = m.info()
+		}
+		geoResponse(w, resp)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// DNS_TTL is the TTL of the DNS answers, the databases are updated weekly at most
+const DNS_TTL uint32 = 3600
+
+// dnsServer answers the DNS queries of the IPs under its zone, like the Team Cymru IP to ASN service, for the network
+// gear and mail filters only speaking DNS: the labels of the IP in reverse order (ex: "4.3.2.1.geo." for 1.2.3.4, or
+// its 32 nibbles for an IPv6, as in ip6.arpa). The TXT record is "<asn> | <network> | <country code> | <as org>",
+// the A record 127.0.<letter>.<letter> the ASCII codes of its country code (ex: 127.0.85.83 for US).
+type dnsServer struct {
+	// Lowercase and fully qualified, ex: "geo.example.com."
+	zone   string
+	lookup lookupFunc
+}
+
+func newDNSServer(zone string, lookup lookupFunc) *dnsServer {
+	return &dnsServer{zone: dns.Fqdn(strings.ToLower(zone)), lookup: lookup}
+}
+
+// serveDNS serves the queries over UDP and TCP on address
+func serveDNS(handler dns.Handler, address string) error {
+	errs := make(chan error, 2)
+	for _, network := range []string{"udp", "tcp"} {
+		server := &dns.Server{Addr: address, Net: network, Handler: handler}
+		go func() {
+			errs <- server.ListenAndServe()
+		}()
+	}
+	log.Info().Msg(fmt.Sprintf("Serving DNS on '%s' (UDP and TCP)", address))
+	return <-errs
+}
+
+func (s *dnsServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Authoritative = true
+	resp.Rcode = s.answer(req, resp)
+	if err := w.WriteMsg(resp); err != nil {
+		log.Error().Err(err).Msg("")
+	}
+}
+
+// answer adds the answers of the question of req to resp, returning the response code
+func (s *dnsServer) answer(req *dns.Msg, resp *dns.Msg) int {
+	if req.Opcode != dns.OpcodeQuery || len(req.Question) != 1 {
+		return dns.RcodeNotImplemented
+	}
+	question := req.Question[0]
+	name := strings.ToLower(question.Name)
+	if !dns.IsSubDomain(s.zone, name) {
+		return dns.RcodeRefused
+	}
+	if name == s.zone {
+		return dns.RcodeSuccess
+	}
+
+	ip := reverseLabelsIP(strings.TrimSuffix(name, "."+s.zone))
+	if ip == nil || isBogon(ip) {
+		return dns.RcodeNameError
+	}
+	ipStr := ip.String()
+	log.Info().Msg(fmt.Sprintf("Looking up IP '%s' (DNS)", logIP(ipStr)))
+
+	record, err := s.lookup(context.Background(), ipStr, ip, nil)
+	if err != nil {
+		var statusErr lookupStatusError
+		if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+			return dns.RcodeNameError
+		}
+		log.Err(err).Msg("Lookup error")
+		return dns.RcodeServerFailure
+	}
+	summary := summarize(record)
+	// Not in the databases
+	if summary.CountryCode == "" && summary.ASN == 0 {
+		return dns.RcodeNameError
+	}
+
+	header := dns.RR_Header{Name: question.Name, Class: dns.ClassINET, Rrtype: question.Qtype, Ttl: DNS_TTL}
+	switch question.Qtype {
+	case dns.TypeTXT, dns.TypeANY:
+		header.Rrtype = dns.TypeTXT
+		asn := ""
+		if summary.ASN != 0 {
+			asn = strconv.FormatUint(uint64(summary.ASN), 10)
+		}
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: header,
+			Txt: []string{strings.Join([]string{asn, summary.Network, summary.CountryCode, summary.ASOrg}, " | ")},
+		})
+	case dns.TypeA:
+		if len(summary.CountryCode) == 2 {
+			resp.Answer = append(resp.Answer, &dns.A{
+				Hdr: header,
+				A:   net.IPv4(127, 0, summary.CountryCode[0], summary.CountryCode[1]),
+			})
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// reverseLabelsIP parses the IP of the labels of a reverse DNS name, ex: "4.3.2.1" for 1.2.3.4, nil if invalid
+func reverseLabelsIP(labels string) net.IP {
+	parts := strings.Split(labels, ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	switch len(parts) {
+	case net.IPv4len:
+		return net.ParseIP(strings.Join(parts, ".")).To4()
+	case net.IPv6len * 2:
+		var ip strings.Builder
+		for i, nibble := range parts {
+			if len(nibble) != 1 {
+				return nil
+			}
+			if i > 0 && i%4 == 0 {
+				ip.WriteByte(':')
+			}
+			ip.WriteString(nibble)
+		}
+		return net.ParseIP(ip.String())
+	}
+	return nil
+}
+
+// ipSummary are the fields of a lookup served by the text protocols
+type ipSummary struct {
+	ASN         uint
+	Network     string
+	CountryCode string
+	Region      string
+	City        string
+	ASOrg       string
+}
+
+// summarize returns the summary of the response of a lookup, with the ASN when an ASN edition is loaded
+func summarize(resp interface{}) ipSummary {
+	switch resp := resp.(type) {
+	case geoResponseStruct:
+		summary := ipSummary{Network: resp.Network, CountryCode: resp.CountryCode, Region: resp.StateCode, City: resp.CityName}
+		if resp.ispStruct != nil {
+			summary.ASN, summary.ASOrg = resp.ASN, resp.ASOrg
+		}
+		return summary
+	case asnResponseStruct:
+		return ipSummary{ASN: resp.ASN, Network: resp.Network, ASOrg: resp.Organization}
+	}
+	return ipSummary{}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// domainStruct is the field of the GeoIP2-Domain edition, added to the city responses when it is loaded
+type domainStruct struct {
+	// Second level domain of the ISP, ex: "example.com"
+	Domain string `json:"domain"`
+}
+
+type domainResponseStruct struct {
+	IP string `json:"ip"`
+	*domainStruct
+}
+
+// isDomain reports whether the database supports domain lookups (Domain edition)
+func (m *maxmind) isDomain() bool {
+	db := m.acquire()
+	defer db.release()
+	_, err := db.Domain(net.IPv4zero)
+	return !errors.As(err, &geoip2.InvalidMethodError{})
+}
+
+func (m *maxmind) domain(ctx context.Context, ip net.IP) (*domainStruct, error) {
+	record, err := m.record(ctx, "domain", ip, func(db *sharedReader) (interface{}, error) {
+		return db.Domain(ip)
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return nil, err
+	}
+	return &domainStruct{Domain: record.(*geoip2.Domain).Domain}, nil
+}
+
+func (m *maxmind) lookupDomain(ctx context.Context, ipStr string, ip net.IP, _ []string) (interface{}, error) {
+	domain, err := m.domain(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	return domainResponseStruct{IP: ipStr, domainStruct: domain}, nil
+}
+
+// enrichDomain adds the domain field to the city responses
+func (m *maxmind) enrichDomain(ctx context.Context, ip net.IP, resp *geoResponseStruct) error {
+	domain, err := m.domain(ctx, ip)
+	if err != nil {
+		return err
+	}
+	resp.domainStruct = domain
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"time"
+
+	"geoip-server/pkg/geoip"
+	"github.com/spf13/pflag"
+)
+
+// downloader downloads the editions, with the --download flags of the serve command
+var downloader = &geoip.Downloader{}
+
+// downloadOptions are the HTTP client settings of the database downloads, for the serve and update commands
+type downloadOptions struct {
+	timeout             time.Duration
+	tlsHandshakeTimeout time.Duration
+	proxy               string
+	url                 string
+	checksums           []string
+}
+
+func addDownloadFlags(flags *pflag.FlagSet) *downloadOptions {
+	options := &downloadOptions{}
+	flags.DurationVar(&options.timeout, "download-timeout", 10*time.Minute, "Timeout of a database download, including reading it, disabled when 0")
+	flags.DurationVar(&options.tlsHandshakeTimeout, "download-tls-handshake-timeout", 10*time.Second, "Timeout of the TLS handshake of the downloads, disabled when 0")
+	flags.StringVar(&options.proxy, "download-proxy", "", "Proxy of the downloads (ex: http://proxy:3128), otherwise the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables")
+	flags.StringVar(&options.url, "download-url", "", "URL to download the databases from instead of Maxmind (ex: an internal mirror), with {edition} and {md5} replaced")
+	flags.StringSliceVar(&options.checksums, "expected-checksum", []string{}, "Checksum the downloaded databases must have, md5:<hex> or sha256:<hex>, prefixed with <edition>= for one of the editions, can be repeated")
+	return options
+}
+
+func (o *downloadOptions) downloader() (*geoip.Downloader, error) {
+	client, err := geoip.NewClient(o.timeout, o.tlsHandshakeTimeout, o.proxy)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := geoip.ParseChecksums(o.checksums)
+	if err != nil {
+		return nil, err
+	}
+	return &geoip.Downloader{Client: client, URL: o.url, Checksums: checksums}, nil
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+)
+
+// DOWNLOAD_LEASE_DURATION is the time after its last renewal that the lease of the downloading replica expires, for
+// another replica to take over. It is renewed every DOWNLOAD_LEASE_RENEW.
+const (
+	DOWNLOAD_LEASE_DURATION time.Duration = time.Minute
+	DOWNLOAD_LEASE_RENEW    time.Duration = 20 * time.Second
+)
+
+// The --download-lock file is written under a mutex file, created exclusively: the replicas wait at most
+// DOWNLOAD_LOCK_WAIT for it, and one older than DOWNLOAD_LOCK_STALE was left by a replica that crashed holding it
+const (
+	DOWNLOAD_LOCK_WAIT  time.Duration = time.Second
+	DOWNLOAD_LOCK_STALE time.Duration = 10 * time.Second
+)
+
+// KUBERNETES_SERVICE_ACCOUNT is the directory of the service account token, CA and namespace mounted in the pods
+const KUBERNETES_SERVICE_ACCOUNT string = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// election elects the replica downloading the databases to the shared --data-dir, with --download-lock or
+// --download-lease. When nil every replica downloads.
+var election *downloadElection
+
+// leaseStore holds the lease of the downloading replica
+type leaseStore interface {
+	// tryAcquire takes the lease for identity when free or expired, or renews it when already held, reporting
+	// whether identity holds it
+	tryAcquire(identity string) (bool, error)
+}
+
+// downloadElection keeps trying to hold the lease: the replica holding it downloads the databases to the shared
+// --data-dir, the others reload them from there
+type downloadElection struct {
+	store    leaseStore
+	identity string
+	leading  atomic.Bool
+}
+
+func newDownloadElection(lockPath string, lease string) (*downloadElection, error) {
+	if lockPath == "" && lease == "" {
+		return nil, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	// The pod name, and the process to tell apart the replicas of a host
+	identity := hostname + "_" + strconv.Itoa(os.Getpid())
+
+	var store leaseStore
+	switch {
+	case lockPath != "" && lease != "":
+		return nil, fmt.Errorf("only one of --download-lock and --download-lease can be set")
+	case lockPath != "":
+		store = &fileLease{path: lockPath}
+	default:
+		if store, err = newKubernetesLease(lease); err != nil {
+			return nil, err
+		}
+	}
+	return &downloadElection{store: store, identity: identity}, nil
+}
+
+// leader reports whether this replica downloads the databases
+func (e *downloadElection) leader() bool {
+	return e == nil || e.leading.Load()
+}
+
+// start tries to hold the lease, then keeps renewing it (or, when another replica holds it, trying to take it over
+// once expired) in the background
+func (e *downloadElection) start() {
+	if e.try(); !e.leader() {
+		log.Info().Msg(fmt.Sprintf("Reloading the databases downloaded by another replica (identity: '%s')", e.identity))
+	}
+	go func() {
+		for {
+			// With a jitter, for the replicas not to race to take over an expired lease
+			time.Sleep(DOWNLOAD_LEASE_RENEW + time.Duration(rand.Int63n(int64(DOWNLOAD_LEASE_RENEW/4))))
+			e.try()
+		}
+	}()
+}
+
+// followSharedDatabases reloads the databases of the shared --data-dir every interval when they changed, ex: after the
+// downloading replica updated them, while this replica doesn't download
+func followSharedDatabases(databases []*maxmind, creds *maxmindCredentials, interval time.Duration) {
+	modTimes := map[*maxmind]time.Time{}
+	for _, m := range databases {
+		if info, err := os.Stat(m.cachePath()); err == nil {
+			modTimes[m] = info.ModTime()
+		}
+	}
+	for {
+		time.Sleep(interval)
+		if election.leader() {
+			continue
+		}
+		for _, m := range databases {
+			info, err := os.Stat(m.cachePath())
+			if err != nil || info.ModTime().Equal(modTimes[m]) {
+				continue
+			}
+			modTimes[m] = info.ModTime()
+			m.update(creds.get())
+		}
+	}
+}
+
+func (e *downloadElection) try() {
+	held, err := e.store.tryAcquire(e.identity)
+	if err != nil {
+		// Not renewed, the lease expires and another replica takes over
+		log.Error().Err(err).Msg("Acquiring the download lease failed")
+		held = false
+	}
+	if wasLeading := e.leading.Swap(held); held != wasLeading {
+		if held {
+			log.Info().Msg(fmt.Sprintf("Downloading the databases for the replicas (identity: '%s')", e.identity))
+		} else {
+			log.Info().Msg(fmt.Sprintf("Reloading the databases downloaded by another replica (identity: '%s')", e.identity))
+		}
+	}
+}
+
+// leaseRecord is the content of a --download-lock file
+type leaseRecord struct {
+	Holder    string    `json:"holder"`
+	RenewTime time.Time `json:"renew_time"`
+}
+
+// fileLease is a lease in a file of the shared storage. It is read and written under a "<path>.mutex" file created
+// with O_EXCL, which is atomic on the local file systems and NFS (v3 and later), unlike flock on some of them.
+type fileLease struct {
+	path string
+}
+
+func (l *fileLease) read() (*leaseRecord, error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	content, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return nil, err
+	}
+	record := &leaseRecord{}
+	if err := json.Unmarshal(content, record); err != nil {
+		return nil, fmt.Errorf("invalid download lock file '%s': %w", l.path, err)
+	}
+	return record, nil
+}
+
+// lock creates the mutex file, waiting for the replica holding it, and returns its removal
+func (l *fileLease) lock() (func(), error) {
+	mutex := l.path + ".mutex"
+	deadline := time.Now().Add(DOWNLOAD_LOCK_WAIT)
+	for {
+		file, err := os.OpenFile(mutex, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(mutex) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		// Held for milliseconds by the live replicas
+		if info, err := os.Stat(mutex); err == nil && time.Since(info.ModTime()) > DOWNLOAD_LOCK_STALE {
+			log.Warn().Msg(fmt.Sprintf("Removing the stale download lock mutex '%s'", mutex))
+			os.Remove(mutex)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the download lock mutex '%s' is held by another replica", mutex)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (l *fileLease) tryAcquire(identity string) (bool, error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	unlock, err := l.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	current, err := l.read()
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if current != nil && current.Holder != identity && time.Since(current.RenewTime) < DOWNLOAD_LEASE_DURATION {
+		return false, nil
+	}
+
+	content, err := json.Marshal(leaseRecord{Holder: identity, RenewTime: time.Now().UTC()})
+	if err != nil {
+		return false, err
+	}
+	// Replaced by a rename, never read half written
+	temp := filepath.Join(filepath.Dir(l.path), "."+filepath.Base(l.path)+"."+identity+".tmp")
+	if err := ioutil.WriteFile(temp, content, 0644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(temp, l.path); err != nil {
+		os.Remove(temp)
+		return false, err
+	}
+	return true, nil
+}
+
+// kubernetesLease is a coordination.k8s.io Lease, updated through the API server with the service account of the
+// pod (it needs the get, create and update verbs on leases)
+type kubernetesLease struct {
+	// Of the leases of the namespace
+	url       string
+	namespace string
+	name      string
+	client    *http.Client
+}
+
+// kubernetesLeaseStruct is the subset of the Lease object read and written
+type kubernetesLeaseStruct struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// KUBERNETES_MICRO_TIME is the format of the Lease times
+const KUBERNETES_MICRO_TIME string = "2006-01-02T15:04:05.000000Z07:00"
+
+// newKubernetesLease returns the Lease "<namespace>/<name>", or "<name>" in the namespace of the pod
+func newKubernetesLease(lease string) (*kubernetesLease, error) {
+	namespace, name, ok := strings.Cut(lease, "/")
+	if !ok {
+		content, err := ioutil.ReadFile(filepath.Join(KUBERNETES_SERVICE_ACCOUNT, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("reading the namespace of the pod for --download-lease: %w", err)
+		}
+		namespace, name = strings.TrimSpace(string(content)), lease
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" {
+		return nil, fmt.Errorf("--download-lease is only available in a Kubernetes pod (KUBERNETES_SERVICE_HOST is not set)")
+	}
+
+	ca, err := ioutil.ReadFile(filepath.Join(KUBERNETES_SERVICE_ACCOUNT, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	return &kubernetesLease{
+		url:       fmt.Sprintf("https://%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", net.JoinHostPort(host, port), namespace),
+		namespace: namespace,
+		name:      name,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// errLeaseConflict is a Lease written by another replica in between
+var errLeaseConflict = errors.New("lease conflict")
+
+// request sends a Lease (or with PATCH, a JSON merge patch of it) to the API server, or reads the Lease when body is
+// nil, returning the Lease of the response or nil when not found
+func (l *kubernetesLease) request(method string, url string, body interface{}) (*kubernetesLeaseStruct, error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	var content []byte
+	if body != nil {
+		var err error
+		if content, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	// Read at every request, as the kubelet rotates it
+	token, err := ioutil.ReadFile(filepath.Join(KUBERNETES_SERVICE_ACCOUNT, "token"))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+		return nil, nil
+	case resp.StatusCode == http.StatusConflict:
+		return nil, errLeaseConflict
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("the Kubernetes API responded with status %d: %s", resp.StatusCode, content)
+	}
+	result := &kubernetesLeaseStruct{}
+	return result, json.Unmarshal(content, result)
+}
+
+func (l *kubernetesLease) tryAcquire(identity string) (bool, error) {
+	current, err := l.request(http.MethodGet, l.url+"/"+l.name, nil)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC().Format(KUBERNETES_MICRO_TIME)
+
+	if current == nil {
+		lease := &kubernetesLeaseStruct{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+		lease.Metadata.Name = l.name
+		lease.Metadata.Namespace = l.namespace
+		lease.Spec.HolderIdentity = identity
+		lease.Spec.LeaseDurationSeconds = int(DOWNLOAD_LEASE_DURATION.Seconds())
+		lease.Spec.AcquireTime = now
+		lease.Spec.RenewTime = now
+		_, err := l.request(http.MethodPost, l.url, lease)
+		if err == errLeaseConflict {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	if current.Spec.HolderIdentity != identity {
+		renewTime, _ := time.Parse(KUBERNETES_MICRO_TIME, current.Spec.RenewTime)
+		duration := time.Duration(current.Spec.LeaseDurationSeconds) * time.Second
+		if current.Spec.HolderIdentity != "" && time.Since(renewTime) < duration {
+			return false, nil
+		}
+		current.Spec.HolderIdentity = identity
+		current.Spec.AcquireTime = now
+		current.Spec.LeaseTransitions++
+	}
+	current.Spec.LeaseDurationSeconds = int(DOWNLOAD_LEASE_DURATION.Seconds())
+	current.Spec.RenewTime = now
+	// Only the spec fields read are patched, the rest of the Lease (ex: its labels and annotations) is kept. Rejected
+	// with a conflict when another replica updated it since, as the resourceVersion changed.
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": current.Metadata.ResourceVersion},
+		"spec":     current.Spec,
+	}
+	_, err = l.request(http.MethodPatch, l.url+"/"+l.name, patch)
+	if err == errLeaseConflict {
+		return false, nil
+	}
+	return err == nil, err
+}
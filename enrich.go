@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"github.com/rs/zerolog/log"
+)
+
+// enrichFunc adds the data of another database to a city response
+type enrichFunc func(ctx context.Context, ip net.IP, resp *geoResponseStruct) error
+
+// enrichedLookup adds the data of the enrichers to the city responses of lookup. The fields of a failed enricher are
+// left out, the lookup still succeeds.
+func enrichedLookup(lookup lookupFunc, enrichers []enrichFunc) lookupFunc {
+	if len(enrichers) == 0 {
+		return lookup
+	}
+
+	return func(ctx context.Context, ipStr string, ip net.IP, langs []string) (interface{}, error) {
+		resp, err := lookup(ctx, ipStr, ip, langs)
+		if err != nil {
+			return nil, err
+		}
+		geo, ok := resp.(geoResponseStruct)
+		if !ok {
+			return resp, nil
+		}
+
+		for _, enrich := range enrichers {
+			if err := enrich(ctx, ip, &geo); err != nil {
+				log.Err(err).Msg("Enrichment error")
+			}
+		}
+		return geo, nil
+	}
+}
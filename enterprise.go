@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// enterpriseStruct are the fields of the GeoIP2-Enterprise edition not in the City one. The confidences are from 0
+// to 100.
+type enterpriseStruct struct {
+	ConnectionType    string `json:"connection_type"`
+	UserType          string `json:"user_type"`
+	CountryConfidence uint8  `json:"country_confidence"`
+	CityConfidence    uint8  `json:"city_confidence"`
+	PostalConfidence  uint8  `json:"postal_confidence"`
+}
+
+// isEnterprise reports whether the database supports Enterprise lookups (Enterprise edition)
+func (m *maxmind) isEnterprise() bool {
+	db := m.acquire()
+	defer db.release()
+	_, err := db.Enterprise(net.IPv4zero)
+	return !errors.As(err, &geoip2.InvalidMethodError{})
+}
+
+func (m *maxmind) lookupEnterprise(ctx context.Context, ipStr string, ip net.IP, langs []string) (interface{}, error) {
+	network, found, err := m.match(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	record, err := m.record(ctx, "enterprise", ip, func(db *sharedReader) (interface{}, error) {
+		return db.Enterprise(ip)
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return nil, err
+	}
+	geo := record.(*geoip2.Enterprise)
+
+	resp := cityResponse(ipStr, enterpriseCity(geo), langs)
+	resp.Network = network
+	resp.Found = found
+	resp.enterpriseStruct = &enterpriseStruct{
+		ConnectionType:    geo.Traits.ConnectionType,
+		UserType:          geo.Traits.UserType,
+		CountryConfidence: geo.Country.Confidence,
+		CityConfidence:    geo.City.Confidence,
+		PostalConfidence:  geo.Postal.Confidence,
+	}
+	return resp, nil
+}
+
+// enterpriseCity returns the city record part of an Enterprise record, the names are shared
+func enterpriseCity(geo *geoip2.Enterprise) *geoip2.City {
+	city := &geoip2.City{}
+	city.City.GeoNameID = geo.City.GeoNameID
+	city.City.Names = geo.City.Names
+	city.Continent = geo.Continent
+	city.Country.GeoNameID = geo.Country.GeoNameID
+	city.Country.IsInEuropeanUnion = geo.Country.IsInEuropeanUnion
+	city.Country.IsoCode = geo.Country.IsoCode
+	city.Country.Names = geo.Country.Names
+	city.Location = geo.Location
+	city.Postal.Code = geo.Postal.Code
+	city.RegisteredCountry.GeoNameID = geo.RegisteredCountry.GeoNameID
+	city.RegisteredCountry.IsInEuropeanUnion = geo.RegisteredCountry.IsInEuropeanUnion
+	city.RegisteredCountry.IsoCode = geo.RegisteredCountry.IsoCode
+	city.RegisteredCountry.Names = geo.RegisteredCountry.Names
+	city.RepresentedCountry = geo.RepresentedCountry
+	for _, subdivision := range geo.Subdivisions {
+		city.Subdivisions = append(city.Subdivisions, struct {
+			GeoNameID uint              `maxminddb:"geoname_id"`
+			IsoCode   string            `maxminddb:"iso_code"`
+			Names     map[string]string `maxminddb:"names"`
+		}{subdivision.GeoNameID, subdivision.IsoCode, subdivision.Names})
+	}
+	city.Traits.IsAnonymousProxy = geo.Traits.IsAnonymousProxy
+	city.Traits.IsSatelliteProvider = geo.Traits.IsSatelliteProvider
+	return city
+}
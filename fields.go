@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// selectedFields is a response reduced to some of its fields, encoded in the requested order
+type selectedFields struct {
+	names  []string
+	values map[string]jsoniter.RawMessage
+}
+
+func (s selectedFields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, name := range s.names {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(s.values[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// requestFields returns the fields asked for with ?fields=country_code,city, nil for all of them
+func requestFields(request *http.Request) []string {
+	var fields []string
+	for _, field := range strings.Split(request.URL.Query().Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// selectFields reduces resp to the given fields, those it does not have are left out and returned as unknown
+func selectFields(resp interface{}, fields []string) (interface{}, []string, error) {
+	if len(fields) == 0 {
+		return resp, nil, nil
+	}
+
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	var values map[string]jsoniter.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, nil, err
+	}
+
+	selected := selectedFields{values: values}
+	var unknown []string
+	for _, field := range fields {
+		if _, ok := values[field]; ok {
+			selected.names = append(selected.names, field)
+		} else {
+			unknown = append(unknown, field)
+		}
+	}
+	return selected, unknown, nil
+}
+
+// unknownFieldsMessage is the error message of the fields a response does not have
+func unknownFieldsMessage(unknown []string) string {
+	if len(unknown) == 1 {
+		return fmt.Sprintf("Unknown field '%s'", unknown[0])
+	}
+	return fmt.Sprintf("Unknown fields '%s'", strings.Join(unknown, "', '"))
+}
+
+// plainValue returns strings unquoted, null and missing values empty and other values as JSON
+func plainValue(value jsoniter.RawMessage) string {
+	iter := jsoniter.ParseBytes(jsoniter.ConfigCompatibleWithStandardLibrary, value)
+	switch iter.WhatIsNext() {
+	case jsoniter.StringValue:
+		return iter.ReadString()
+	case jsoniter.NilValue, jsoniter.InvalidValue:
+		return ""
+	default:
+		return string(value)
+	}
+}
+
+// fieldHandler serves a single field of the response as text, ex: "/geoip/50.19.0.1/country_code" returns "US"
+func fieldHandler(lookup lookupFunc, resolver *clientIPResolver, hostnames *hostnameResolver) httprouter.Handle {
+	return func(w http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+		ipStr, ip, _ := requestIP(w, request, ps, resolver, hostnames)
+		if ip == nil {
+			return
+		}
+		field := ps.ByName("field")
+
+		log.Info().Msg(fmt.Sprintf("Looking up field '%s' of IP '%s'", field, logIP(ipStr)))
+
+		resp, err := lookup(request.Context(), ipStr, ip, requestLanguages(request))
+		if err != nil {
+			status, code, message := lookupError(err)
+			errResponse(w, status, code, message)
+			return
+		}
+
+		// The bogon responses (with --bogon-status=200) have none of the lookup fields, they are empty
+		_, bogon := resp.(bogonResponseStruct)
+		selected, unknown, err := selectFields(resp, []string{field})
+		if err != nil {
+			errResponse(w, http.StatusInternalServerError, ERR_INTERNAL, "")
+			return
+		}
+		if len(unknown) > 0 && !bogon {
+			errResponse(w, http.StatusNotFound, ERR_UNKNOWN_FIELD, unknownFieldsMessage(unknown))
+			return
+		}
+		values := selected.(selectedFields)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Add("Vary", "Accept-Language")
+		if _, err := io.WriteString(w, plainValue(values.values[field])+"\n"); err != nil {
+			log.Error().Err(err).Msg("")
+		}
+	}
+}
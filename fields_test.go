@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestSelectFields(t *testing.T) {
+	resp := asnResponseStruct{IP: "1.2.3.4", ASN: 64496, Organization: "Example"}
+	tests := []struct {
+		fields   []string
+		expected string
+		unknown  []string
+	}{
+		{nil, `{"ip":"1.2.3.4","asn":64496,"organization":"Example","network":""}`, nil},
+		{[]string{"organization", "ip"}, `{"organization":"Example","ip":"1.2.3.4"}`, nil},
+		{[]string{"asn", "nope"}, `{"asn":64496}`, []string{"nope"}},
+		{[]string{"nope", "city"}, `{}`, []string{"nope", "city"}},
+	}
+	for _, test := range tests {
+		selected, unknown, err := selectFields(resp, test.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(selected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("%v: got %s, expected %s", test.fields, data, test.expected)
+		}
+		if strings.Join(unknown, ",") != strings.Join(test.unknown, ",") {
+			t.Errorf("%v: got unknown %v, expected %v", test.fields, unknown, test.unknown)
+		}
+	}
+}
+
+// TestUnknownFields checks that both the ?fields= and the path forms reject the fields the response does not have
+func TestUnknownFields(t *testing.T) {
+	lookup := testCityDatabase(t, NOT_FOUND_EMPTY).lookup()
+	resolver, err := newClientIPResolver(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := httprouter.New()
+	router.GET("/geoip/:ip", lookupHandler(lookup, resolver, nil))
+	router.GET("/geoip/:ip/:field", fieldHandler(lookup, resolver, nil))
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/geoip/216.160.83.56?fields=city,zip_code", http.StatusOK, `{"city":"Milton","zip_code":"98354"}`},
+		{"/geoip/216.160.83.56?fields=nope", http.StatusBadRequest, `"Unknown field 'nope'"`},
+		{"/geoip/216.160.83.56?fields=city,nope,other", http.StatusBadRequest, `"Unknown fields 'nope', 'other'"`},
+		{"/geoip/216.160.83.56/city", http.StatusOK, "Milton\n"},
+		{"/geoip/216.160.83.56/nope", http.StatusNotFound, `"Unknown field 'nope'"`},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if recorder.Code != test.status {
+			t.Errorf("%s: got status %d, expected %d", test.path, recorder.Code, test.status)
+		}
+		if !strings.Contains(recorder.Body.String(), test.body) {
+			t.Errorf("%s: got %s, expected %s", test.path, recorder.Body.String(), test.body)
+		}
+		if test.status != http.StatusOK && !strings.Contains(recorder.Body.String(), `"code":"`+ERR_UNKNOWN_FIELD+`"`) {
+			t.Errorf("%s: expected the code %s in %s", test.path, ERR_UNKNOWN_FIELD, recorder.Body.String())
+		}
+	}
+
+	result := batchResult(t.Context(), lookup, "216.160.83.56", nil, []string{"nope"})
+	if batchErr, ok := result.(batchErrorStruct); !ok || batchErr.Code != ERR_UNKNOWN_FIELD {
+		t.Errorf("batch: got %#v, expected an %s error", result, ERR_UNKNOWN_FIELD)
+	}
+}
+
+// TestBogonFields checks that with --bogon-status=200 the fields of the bogon IPs are empty, not unknown
+func TestBogonFields(t *testing.T) {
+	lookup := bogonLookup(testCityDatabase(t, NOT_FOUND_EMPTY).lookup(), http.StatusOK)
+	resolver, err := newClientIPResolver(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := httprouter.New()
+	router.GET("/geoip/:ip", lookupHandler(lookup, resolver, nil))
+	router.GET("/geoip/:ip/:field", fieldHandler(lookup, resolver, nil))
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/geoip/127.0.0.1/country_code", "\n"},
+		{"/geoip/127.0.0.1/bogon", "true\n"},
+		{"/geoip/127.0.0.1?fields=country_code,bogon", `{"bogon":true}`},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if recorder.Code != http.StatusOK || recorder.Body.String() != test.body {
+			t.Errorf("%s: got %d %q, expected 200 %q", test.path, recorder.Code, recorder.Body.String(), test.body)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+)
+
+// responseFormat encodes lookup responses (a struct, selectedFields, or a slice of them for batches)
+type responseFormat struct {
+	contentType string
+	encode      func(w io.Writer, resp interface{}) error
+}
+
+// formats by ?format= name, the first content type of each is also matched against the Accept header
+var formats = map[string]responseFormat{
+	"json":    {"application/json", encodeJSON},
+	"xml":     {"application/xml", encodeXML},
+	"csv":     {"text/csv", encodeCSV},
+	"geojson": {"application/geo+json", encodeGeoJSON},
+	// Binary encodings, cheaper than JSON for high throughput consumers
+	"msgpack":  {"application/msgpack", encodeMsgpack},
+	"protobuf": {"application/x-protobuf", encodeProtobuf},
+}
+
+// formatAliases are other Accept content types of the formats
+var formatAliases = map[string]string{
+	"text/xml":                        "xml",
+	"application/x-msgpack":           "msgpack",
+	"application/protobuf":            "protobuf",
+	"application/vnd.google.protobuf": "protobuf",
+}
+
+// requestFormat returns the format asked for with ?format=, or else negotiated with the Accept header, JSON by default
+func requestFormat(request *http.Request) (string, error) {
+	if name := request.URL.Query().Get("format"); name != "" {
+		if _, ok := formats[name]; !ok {
+			return "", fmt.Errorf("Unsupported format '%s'", name)
+		}
+		return name, nil
+	}
+
+	for _, accepted := range acceptList(request.Header.Get("Accept")) {
+		mediaType, _, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		if name, ok := formatAliases[mediaType]; ok {
+			return name, nil
+		}
+		for name, format := range formats {
+			if format.contentType == mediaType {
+				return name, nil
+			}
+		}
+	}
+	return "json", nil
+}
+
+// formatResponse writes resp in the format negotiated for the request
+func formatResponse(w http.ResponseWriter, request *http.Request, resp interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	name, err := requestFormat(request)
+	if err != nil {
+		errResponse(w, http.StatusBadRequest, ERR_UNSUPPORTED_FORMAT, err.Error())
+		return
+	}
+	if name == "protobuf" && len(requestFields(request)) > 0 {
+		// The messages have a fixed set of fields, unset ones are not sent anyway
+		errResponse(w, http.StatusBadRequest, ERR_FIELDS_NOT_SUPPORTED, "The fields parameter is not supported with protobuf")
+		return
+	}
+
+	format := formats[name]
+	var buf bytes.Buffer
+	if err := format.encode(&buf, resp); err != nil {
+		log.Error().Err(err).Msg("Response encoding error")
+		errResponse(w, http.StatusInternalServerError, ERR_INTERNAL, "")
+		return
+	}
+	w.Header().Set("Content-Type", format.contentType)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Error().Err(err).Msg("")
+	}
+}
+
+func encodeJSON(w io.Writer, resp interface{}) error {
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// encodeXML writes the JSON representation of resp as XML, in the freegeoip layout: a <Response> element (inside
+// <Responses> for batches) with the fields in CamelCase, ex: <CountryCode>
+func encodeXML(w io.Writer, resp interface{}) error {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	iter := jsoniter.ParseBytes(json, data)
+	name := "Response"
+	if iter.WhatIsNext() == jsoniter.ArrayValue {
+		name = "Responses"
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	writeXMLValue(encoder, name, iter)
+	if iter.Error != nil {
+		return iter.Error
+	}
+	return encoder.Flush()
+}
+
+func writeXMLValue(encoder *xml.Encoder, name string, iter *jsoniter.Iterator) {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	// Token errors are returned by the final Flush
+	_ = encoder.EncodeToken(start)
+
+	switch iter.WhatIsNext() {
+	case jsoniter.ObjectValue:
+		for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+			writeXMLValue(encoder, xmlName(field), iter)
+		}
+	case jsoniter.ArrayValue:
+		item := strings.TrimSuffix(name, "s")
+		if item == name {
+			item = "Item"
+		}
+		for iter.ReadArray() {
+			writeXMLValue(encoder, item, iter)
+		}
+	case jsoniter.StringValue:
+		_ = encoder.EncodeToken(xml.CharData(iter.ReadString()))
+	case jsoniter.NumberValue:
+		_ = encoder.EncodeToken(xml.CharData(iter.ReadNumber().String()))
+	case jsoniter.BoolValue:
+		_ = encoder.EncodeToken(xml.CharData(fmt.Sprint(iter.ReadBool())))
+	default:
+		iter.Skip()
+	}
+
+	_ = encoder.EncodeToken(start.End())
+}
+
+// xmlAcronyms are kept upper case in the XML element names
+var xmlAcronyms = map[string]bool{"ip": true, "asn": true, "id": true, "eu": true}
+
+// xmlName converts a JSON field name to CamelCase, ex: country_code to CountryCode and ip to IP
+func xmlName(field string) string {
+	parts := strings.Split(field, "_")
+	for i, part := range parts {
+		if xmlAcronyms[part] {
+			parts[i] = strings.ToUpper(part)
+		} else if part != "" {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// freegeoipResponseStruct is the response of freegeoip.net, with its field names and order
+type freegeoipResponseStruct struct {
+	XMLName     xml.Name `json:"-" xml:"Response"`
+	IP          string   `json:"ip" xml:"IP"`
+	CountryCode string   `json:"country_code" xml:"CountryCode"`
+	CountryName string   `json:"country_name" xml:"CountryName"`
+	RegionCode  string   `json:"region_code" xml:"RegionCode"`
+	RegionName  string   `json:"region_name" xml:"RegionName"`
+	City        string   `json:"city" xml:"City"`
+	ZipCode     string   `json:"zip_code" xml:"ZipCode"`
+	TimeZone    string   `json:"time_zone" xml:"TimeZone"`
+	Latitude    float64  `json:"latitude" xml:"Latitude"`
+	Longitude   float64  `json:"longitude" xml:"Longitude"`
+	MetroCode   int      `json:"metro_code" xml:"MetroCode"`
+}
+
+// ipstackResponseStruct is the response of the ipstack (formerly freegeoip) API
+type ipstackResponseStruct struct {
+	IP string `json:"ip"`
+	// ipv4 or ipv6
+	Type          string                `json:"type"`
+	ContinentCode string                `json:"continent_code"`
+	ContinentName string                `json:"continent_name"`
+	CountryCode   string                `json:"country_code"`
+	CountryName   string                `json:"country_name"`
+	RegionCode    string                `json:"region_code"`
+	RegionName    string                `json:"region_name"`
+	City          string                `json:"city"`
+	Zip           string                `json:"zip"`
+	Latitude      float64               `json:"latitude"`
+	Longitude     float64               `json:"longitude"`
+	Location      ipstackLocationStruct `json:"location"`
+	TimeZone      ipstackTimeZoneStruct `json:"time_zone"`
+}
+
+type ipstackLocationStruct struct {
+	GeonameID        uint   `json:"geoname_id"`
+	CountryFlagEmoji string `json:"country_flag_emoji"`
+	IsEU             bool   `json:"is_eu"`
+}
+
+type ipstackTimeZoneStruct struct {
+	ID string `json:"id"`
+}
+
+// freegeoipRoutes serves the freegeoip.net API: /json/<ip>, /xml/<ip> and /csv/<ip> (a row without header), the
+// client IP without one
+func freegeoipRoutes(router *httprouter.Router, prefix string, c *compatContext) {
+	for _, format := range []string{"json", "xml", "csv"} {
+		route := prefix + "/" + format + "/*ip"
+		router.GET(route, c.apiRoute(route, freegeoipHandler(c, format)))
+	}
+}
+
+func freegeoipHandler(c *compatContext, format string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ip := strings.TrimPrefix(ps.ByName("ip"), "/")
+		geo, ok := c.lookupCity(w, r, httprouter.Params{{Key: "ip", Value: ip}})
+		if !ok {
+			return
+		}
+		resp := freegeoipResponseStruct{
+			IP:          geo.IP,
+			CountryCode: geo.CountryCode,
+			CountryName: geo.CountryName,
+			RegionCode:  geo.StateCode,
+			RegionName:  geo.StateName,
+			City:        geo.CityName,
+			ZipCode:     geo.PostalCode,
+			TimeZone:    geo.TimeZone,
+			Latitude:    geo.Latitude,
+			Longitude:   geo.Longitude,
+			MetroCode:   geo.MetroCode,
+		}
+
+		var err error
+		switch format {
+		case "xml":
+			w.Header().Set("Content-Type", "application/xml")
+			_, err = w.Write([]byte(xml.Header))
+			if err == nil {
+				err = xml.NewEncoder(w).Encode(resp)
+			}
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			writer := csv.NewWriter(w)
+			err = writer.Write([]string{
+				resp.IP, resp.CountryCode, resp.CountryName, resp.RegionCode, resp.RegionName, resp.City, resp.ZipCode,
+				resp.TimeZone, strconv.FormatFloat(resp.Latitude, 'f', -1, 64),
+				strconv.FormatFloat(resp.Longitude, 'f', -1, 64), strconv.Itoa(resp.MetroCode),
+			})
+			writer.Flush()
+			if err == nil {
+				err = writer.Error()
+			}
+		default:
+			geoResponse(w, resp)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("")
+		}
+	}
+}
+
+// ipstackRoot serves the ipstack API: /<ip>, and /check for the client IP. Its access_key parameter is taken as the
+// API key.
+func ipstackRoot(prefix string, c *compatContext) httprouter.Handle {
+	route := prefix + "/:ip"
+	handle := c.apiRoute(route, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ip := strings.TrimPrefix(r.URL.Path, prefix+"/")
+		if strings.Contains(ip, "/") || ip == "" {
+			errResponse(w, http.StatusNotFound, ERR_NOT_FOUND, "Unknown route")
+			return
+		}
+		if ip == "check" {
+			ip = ""
+		}
+		geo, ok := c.lookupCity(w, r, httprouter.Params{{Key: "ip", Value: ip}})
+		if !ok {
+			return
+		}
+
+		ipType := "ipv6"
+		if parsed := net.ParseIP(geo.IP); parsed != nil && parsed.To4() != nil {
+			ipType = "ipv4"
+		}
+		geoResponse(w, ipstackResponseStruct{
+			IP:            geo.IP,
+			Type:          ipType,
+			ContinentCode: geo.ContinentCode,
+			ContinentName: geo.Continent,
+			CountryCode:   geo.CountryCode,
+			CountryName:   geo.CountryName,
+			RegionCode:    geo.StateCode,
+			RegionName:    geo.StateName,
+			City:          geo.CityName,
+			Zip:           geo.PostalCode,
+			Latitude:      geo.Latitude,
+			Longitude:     geo.Longitude,
+			Location: ipstackLocationStruct{
+				GeonameID:        geo.CityGeonameID,
+				CountryFlagEmoji: flagEmoji(geo.CountryCode),
+				IsEU:             geo.IsInEuropeanUnion,
+			},
+			TimeZone: ipstackTimeZoneStruct{ID: geo.TimeZone},
+		})
+	})
+
+	return queryAPIKey("access_key", handle)
+}
+
+// flagEmoji is the flag of a country code, its letters as regional indicator symbols
+func flagEmoji(countryCode string) string {
+	if len(countryCode) != 2 {
+		return ""
+	}
+	var flag strings.Builder
+	for _, letter := range strings.ToUpper(countryCode) {
+		if letter < 'A' || letter > 'Z' {
+			return ""
+		}
+		flag.WriteRune(0x1F1E6 + letter - 'A')
+	}
+	return flag.String()
+}
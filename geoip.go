@@ -1,149 +1,989 @@
 package main
 
 import (
-	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"geoip-server/pkg/geoip"
 	"github.com/json-iterator/go"
 	"github.com/julienschmidt/httprouter"
 	"github.com/oschwald/geoip2-golang"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/pflag"
-	"io/ioutil"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
-	"strings"
 )
 
-const URL_TEMPLATE string = "https://updates.maxmind.com/geoip/databases/%s/update"
+// API_VERSION is the version of the response shapes, the API routes being served under /v1 and aliased unversioned
+const API_VERSION string = "v1"
+
+// Responses for the IPs without a record, see --not-found
+const (
+	NOT_FOUND_EMPTY string = "empty"
+	NOT_FOUND_ERROR string = "404"
+	NOT_FOUND_FIELD string = "found"
+)
 
 type geoResponseStruct struct {
-	IP		  string  `json:"ip"`
+	IP          string  `json:"ip"`
 	CountryCode string  `json:"country_code"`
 	CountryName string  `json:"country_name"`
 	Continent   string  `json:"continent"`
 	StateCode   string  `json:"region_code"`
 	StateName   string  `json:"region_name"`
-	CityName	string  `json:"city"`
+	CityName    string  `json:"city"`
 	PostalCode  string  `json:"zip_code"`
-	TimeZone	string  `json:"time_zone"`
-	Latitude	float64 `json:"latitude"`
+	TimeZone    string  `json:"time_zone"`
+	Latitude    float64 `json:"latitude"`
 	Longitude   float64 `json:"longitude"`
-	MetroCode   int	 `json:"metro_code"`
+	MetroCode   int     `json:"metro_code"`
+	// Radius in kilometers around the coordinates where the IP is likely to be
+	AccuracyRadius   uint16 `json:"accuracy_radius"`
+	ContinentCode    string `json:"continent_code"`
+	CountryGeonameID uint   `json:"country_geoname_id"`
+	StateGeonameID   uint   `json:"region_geoname_id"`
+	CityGeonameID    uint   `json:"city_geoname_id"`
+	// Every subdivision level, from the largest, the region fields are the first one
+	Subdivisions      []subdivisionStruct `json:"subdivisions"`
+	IsInEuropeanUnion bool                `json:"is_in_european_union"`
+	// Network of the record matching the IP, ex: "81.2.69.0/24"
+	Network string `json:"network"`
+	// Whether there is a record for the IP, with --not-found=found
+	Found *bool `json:"found,omitempty"`
+	// The country the IP is registered to (ex: by the ISP), and the one represented by its users (ex: military bases)
+	RegisteredCountry  countryStruct `json:"registered_country"`
+	RepresentedCountry countryStruct `json:"represented_country"`
+	// Set when an Anonymous-IP edition (or --tor-exit-list) is loaded
+	*anonymousIPStruct
+	// Set when an ISP edition is loaded
+	*ispStruct
+	// Set for Enterprise editions
+	*enterpriseStruct
+	// Set when a Domain edition is loaded
+	*domainStruct
 }
 
-type maxmind struct {
-	mutex sync.RWMutex
-	db	*geoip2.Reader
+type countryStruct struct {
+	Code              string `json:"code"`
+	Name              string `json:"name"`
+	GeonameID         uint   `json:"geoname_id"`
+	IsInEuropeanUnion bool   `json:"is_in_european_union"`
+	// Type of the represented country, ex: "military"
+	Type string `json:"type,omitempty"`
+}
+
+type subdivisionStruct struct {
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	GeonameID uint   `json:"geoname_id"`
+}
+
+type countryResponseStruct struct {
+	IP                string `json:"ip"`
+	CountryCode       string `json:"country_code"`
+	CountryName       string `json:"country_name"`
+	IsInEuropeanUnion bool   `json:"is_in_european_union"`
+	Network           string `json:"network"`
+	Found             *bool  `json:"found,omitempty"`
+}
+
+type asnResponseStruct struct {
+	IP           string `json:"ip"`
+	ASN          uint   `json:"asn"`
+	Organization string `json:"organization"`
+	Network      string `json:"network"`
+	Found        *bool  `json:"found,omitempty"`
 }
 
-var m maxmind
+// maxmind is one loaded edition, read from path when set, otherwise downloaded from Maxmind
+// and persisted to dataDir when set
+type maxmind struct {
+	mutex    sync.RWMutex
+	updating sync.Mutex
+	db       *sharedReader
+	edition  string
+	path     string
+	// Whether path is reloaded when it changes, see --watch-db
+	watch   bool
+	dataDir string
+	// Number of previous databases kept in dataDir, see --keep-versions
+	keepVersions int
+	md5          string
+	// The build of db, set on swap to be read without acquiring db (ex: by the ETags)
+	loadedBuildEpoch atomic.Uint64
+
+	lastAttempt    time.Time
+	lastAttemptErr error
+	lastSuccess    time.Time
+	// The last update attempts, newest first
+	history []updateAttemptStruct
+
+	cacheSize  int
+	cacheStats cacheStats
+	redis      *redisCache
+	notFound   string
+}
 
-func main() {
+// serve runs the HTTP (and gRPC) server, the default command
+func serve(args []string) {
 	var (
-		bindIP			 string
-		bindPort		   string
-		prefix			 string
-		license			string
-		accountId		  string
-		updateInterval	 int
-		edition			string
-		allowedOrigins	 []string
+		bindIP               string
+		bindPort             string
+		binds                []string
+		prefix               string
+		license              string
+		licenseFile          string
+		secretsSource        string
+		secretsRefresh       time.Duration
+		accountId            string
+		updateInterval       int
+		updateScheduleExpr   string
+		editions             []string
+		allowedOrigins       []string
+		configFile           string
+		dbPaths              []string
+		watchPaths           []string
+		batchMaxSize         int
+		grpcPort             string
+		dnsPort              string
+		dnsZone              string
+		whoisEnabled         bool
+		whoisPort            string
+		shutdownTimeout      time.Duration
+		dataDir              string
+		readyMaxAge          int
+		keepVersions         int
+		readyMaxUpdateAge    time.Duration
+		lazyStart            bool
+		adminBind            string
+		trustedProxies       []string
+		clientIPHeader       string
+		tlsCert              string
+		tlsKey               string
+		acmeDomains          []string
+		acmeCacheDir         string
+		acmeEmail            string
+		acmeHTTPBind         string
+		apiKeys              []string
+		apiKeysFile          string
+		cacheSize            int
+		jsonp                bool
+		torExitListSource    string
+		bogonStatus          int
+		notFound             string
+		resolveHostnames     bool
+		dnsResolver          string
+		dnsTimeout           time.Duration
+		redisURL             string
+		redisTTL             time.Duration
+		bindUnix             string
+		bindUnixMode         string
+		bindUnixOwner        string
+		h2cEnabled           bool
+		http3Enabled         bool
+		swaggerUI            bool
+		compat               []string
+		compressMinSize      int
+		corsAllowCredentials bool
+		corsExposeHeaders    []string
+		corsVaryOrigin       bool
+		logLevel             string
+		logFormat            string
+		logIPs               string
+		debug                bool
+		statsdAddress        string
+		statsdPrefix         string
+		statsdTags           []string
+		webhookURL           string
+		downloadLock         string
+		downloadLease        string
+		followInterval       time.Duration
+		webhookFormat        string
+		maxConcurrent        int
+		maxQueued            int
+		queueTimeout         time.Duration
 	)
 
-	// TODO: add environment variable configuration
-	pflag.StringVarP(&license, "license", "l", "", "Required: Sign up and generate this in the Maxmind website")
-	pflag.StringVarP(&accountId, "account-id", "a", "0", "Required: Sign up and generate this in the Maxmind website")
-	pflag.StringVarP(&bindIP, "bindip", "b", "0.0.0.0", "The ip address to bind to")
-	pflag.StringVarP(&bindPort, "port", "p", "8080", "Port to listen on")
-	pflag.IntVarP(&updateInterval, "update-interval", "u", 24, "Intervals in hours to check for database updates")
-	pflag.StringVarP(&edition, "edition", "e", "GeoLite2-City", "edition of database to download")
-	pflag.StringVarP(&prefix, "route-prefix", "r", "/geoip", "route prefix for geoip service, must not be empty")
-	pflag.StringSliceVarP(&allowedOrigins, "allowed-origins", "o", []string{}, "Origins for the Access-Control-Allow-Origin header")
-	pflag.Parse()
-
-	db, err := downloadDatabase(edition, accountId, license)
+	flags := pflag.NewFlagSet("serve", pflag.ExitOnError)
+	flags.StringVarP(&license, "license", "l", "", "Required: Sign up and generate this in the Maxmind website")
+	flags.StringVar(&licenseFile, "license-file", "", "File containing the license, ex: a Docker or Kubernetes secret, instead of --license")
+	flags.StringVar(&secretsSource, "secrets-source", "", "Secret manager to fetch the account ID and license from, ex: vault://secret/maxmind, aws-sm://<secret name or ARN> or gcp-sm://projects/<project>/secrets/<secret>")
+	flags.DurationVar(&secretsRefresh, "secrets-refresh", time.Hour, "Interval to fetch the --secrets-source credentials again, to follow their rotation, disabled when 0")
+	flags.StringVarP(&accountId, "account-id", "a", "0", "Required: Sign up and generate this in the Maxmind website")
+	flags.StringVarP(&bindIP, "bindip", "b", "0.0.0.0", "The ip address to bind to")
+	flags.StringVarP(&bindPort, "port", "p", "8080", "Port to listen on")
+	flags.StringSliceVar(&binds, "bind", []string{}, "Address (ip:port) to serve the API on instead of --bindip and --port, can be repeated (ex: 0.0.0.0:8080 and [::]:8080)")
+	flags.StringVar(&bindUnix, "bind-unix", "", "Unix domain socket to listen on instead of the ip and port, ex: /run/geoip/geoip.sock")
+	flags.StringVar(&bindUnixMode, "bind-unix-mode", "0660", "Permissions of the --bind-unix socket")
+	flags.StringVar(&bindUnixOwner, "bind-unix-owner", "", "Owner of the --bind-unix socket, as user:group (names or IDs)")
+	flags.BoolVar(&h2cEnabled, "h2c", false, "Also serve HTTP/2 without TLS (h2c), for HTTP/2-only meshes (ex: behind Envoy)")
+	flags.BoolVar(&http3Enabled, "http3", false, "Experimental: also serve HTTP/3 (QUIC) on the UDP ports of the API, advertised with Alt-Svc, requires TLS")
+	flags.IntVarP(&updateInterval, "update-interval", "u", 24, "Intervals in hours to check for database updates, 0 to disable the automatic updates")
+	flags.StringVar(&updateScheduleExpr, "update-schedule", "", "Cron expression of the database update checks instead of the interval, ex: '0 5 * * *' or 'CRON_TZ=America/New_York 0 5 * * 2,5'")
+	flags.IntVar(&updateRetry.attempts, "update-retries", 5, "Attempts to download a database update before waiting for the next interval, retrying network errors and 429 or 5xx responses")
+	flags.DurationVar(&updateRetry.delay, "update-retry-delay", 30*time.Second, "Delay before the first retry of a failed update, doubled at every attempt with a random jitter")
+	flags.DurationVar(&updateRetry.maxDelay, "update-retry-max-delay", 30*time.Minute, "Maximum delay between the update retries")
+	flags.StringSliceVarP(&editions, "edition", "e", []string{"GeoLite2-City"}, "edition of database to download, can be repeated")
+	flags.StringVarP(&prefix, "route-prefix", "r", "/geoip", "route prefix for geoip service, must not be empty")
+	flags.StringSliceVarP(&allowedOrigins, "allowed-origins", "o", []string{}, "Origins for the Access-Control-Allow-Origin header: exact, * for any, wildcard subdomains (ex: https://*.example.com) or regular expressions prefixed with ~")
+	flags.BoolVar(&corsAllowCredentials, "cors-allow-credentials", false, "Allow the allowed origins to send credentials (cookies, Authorization), with Access-Control-Allow-Credentials")
+	flags.StringSliceVar(&corsExposeHeaders, "cors-expose-headers", []string{}, "Response headers readable by the allowed origins, with Access-Control-Expose-Headers (ex: ETag)")
+	flags.BoolVar(&corsVaryOrigin, "cors-vary-origin", true, "Add Vary: Origin to the responses, as their Access-Control-Allow-Origin is the request origin")
+	flags.StringVar(&logLevel, "log-level", "info", "Minimum level of the logs: debug, info, warn or error")
+	flags.StringVar(&logFormat, "log-format", "json", "Format of the logs: json, or console for humans")
+	flags.StringVar(&logIPs, "log-ips", LOG_IPS_FULL, "How the looked up IPs are logged: 'full', 'truncate' to their /24 (IPv4) or /48 (IPv6) network, or 'hash'")
+	flags.BoolVar(&debug, "debug", false, "Serve the pprof profiles (/debug/pprof/) and expvar variables (/debug/vars) with the admin routes, requires --admin-bind")
+	flags.StringVar(&statsdAddress, "statsd-address", "", "StatsD (ex: the Datadog agent, localhost:8125) to push the request and update metrics to, disabled when empty")
+	flags.StringVar(&statsdPrefix, "statsd-prefix", "geoip.", "Prefix of the StatsD metric names")
+	flags.StringSliceVar(&statsdTags, "statsd-tags", []string{}, "Tags of every StatsD metric, ex: env:prod,service:geoip")
+	flags.StringVar(&downloadLock, "download-lock", "", "Lease file in the shared --data-dir storage electing the only replica downloading the databases, the others reload its downloads")
+	flags.StringVar(&downloadLease, "download-lease", "", "Kubernetes Lease (<namespace>/<name>, or <name> in the pod namespace) electing the only replica downloading the databases to the shared --data-dir")
+	flags.DurationVar(&followInterval, "download-follow-interval", time.Minute, "Interval for the replicas not downloading to check the shared --data-dir for new databases")
+	flags.StringVar(&webhookURL, "webhook-url", "", "URL to POST to when a new database is loaded, with the edition and the old and new build epochs")
+	flags.StringVar(&webhookFormat, "webhook-format", WEBHOOK_FORMAT_JSON, "Body of the --webhook-url requests: 'json', or 'slack' for a Slack (or compatible) incoming webhook message")
+	flags.StringVarP(&configFile, "config", "c", "", "YAML or TOML file with any of these options, keyed by the flag name")
+	flags.StringSliceVarP(&dbPaths, "db-path", "d", []string{}, "Load the database from this .mmdb file instead of downloading it (no credentials needed), can be repeated")
+	flags.StringSliceVar(&watchPaths, "watch-db", []string{}, "Like --db-path, and reload the file whenever it is replaced (ex: by geoipupdate or a ConfigMap mount), can be repeated")
+	flags.IntVar(&batchMaxSize, "batch-max-size", 100, "Maximum number of IPs per batch lookup")
+	flags.StringVar(&grpcPort, "grpc-port", "", "Port to serve the gRPC API on, disabled when empty")
+	flags.StringVar(&dnsPort, "dns-port", "", "Port to answer the DNS queries of the IPs under --dns-zone on (UDP and TCP), disabled when empty")
+	flags.StringVar(&dnsZone, "dns-zone", "geo", "Zone of the DNS queries, ex: 4.3.2.1.geo.example.com for 1.2.3.4 with geo.example.com")
+	flags.BoolVar(&whoisEnabled, "whois", false, "Answer the IPs sent per line over TCP on --whois-port, like the Team Cymru whois (with begin/end bulk mode)")
+	flags.StringVar(&whoisPort, "whois-port", "4343", "Port of the --whois lookups")
+	flags.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "Time to wait for in-flight requests on SIGTERM/SIGINT")
+	serverOpts := addServerFlags(flags)
+	kafkaOpts := addKafkaFlags(flags)
+	flags.IntVar(&maxConcurrent, "max-concurrent-requests", 0, "Maximum number of API requests served at once, the next ones queued or answered 503, disabled when 0")
+	flags.IntVar(&maxQueued, "max-queued-requests", 0, "Maximum number of API requests waiting for --max-concurrent-requests, the next ones answered 503, unbounded when 0")
+	flags.DurationVar(&queueTimeout, "queue-timeout", 100*time.Millisecond, "Time for an API request to wait for --max-concurrent-requests before being answered 503, not queued when 0")
+	flags.StringVar(&dataDir, "data-dir", "", "Directory to persist downloaded databases to, reused at startup when younger than the update interval")
+	flags.IntVar(&keepVersions, "keep-versions", 0, "Number of previous databases to keep in --data-dir, to roll back to with POST /admin/rollback or the rollback command")
+	flags.IntVar(&readyMaxAge, "ready-max-age", 0, "Days after the database build time for /readyz to fail, disabled when 0")
+	flags.DurationVar(&readyMaxUpdateAge, "ready-max-update-age", 0, "Time since the last successful database update (or check) for /readyz to fail, ex: 72h, disabled when 0")
+	downloadOptions := addDownloadFlags(flags)
+	flags.BoolVar(&lazyStart, "lazy-start", false, "Listen right away, answering 503 to the lookups until the databases are loaded, and retry the initial download instead of exiting")
+	flags.StringVar(&adminBind, "admin-bind", "", "Address (ip:port) to serve the admin routes on, instead of the main port (where they need --api-keys)")
+	flags.StringSliceVar(&trustedProxies, "trusted-proxies", []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7"}, "Proxies (CIDRs or IPs) whose forwarding headers (X-Real-IP, Forwarded, X-Forwarded-For) are trusted for the client IP")
+	flags.StringVar(&clientIPHeader, "client-ip-header", "", "Only header carrying the client IP (ex: CF-Connecting-IP, True-Client-IP), instead of X-Real-IP, Forwarded and X-Forwarded-For")
+	flags.StringVar(&tlsCert, "tls-cert", "", "PEM certificate (chain) file to serve HTTPS and gRPC over TLS, requires --tls-key")
+	flags.StringVar(&tlsKey, "tls-key", "", "PEM private key file of --tls-cert")
+	flags.StringSliceVar(&acmeDomains, "acme-domains", []string{}, "Domains to obtain and renew Let's Encrypt certificates for, to serve HTTPS without --tls-cert")
+	flags.StringVar(&acmeCacheDir, "acme-cache-dir", "acme-cache", "Directory to store the Let's Encrypt account and certificates in")
+	flags.StringVar(&acmeEmail, "acme-email", "", "Contact email for the Let's Encrypt account, optional")
+	flags.StringVar(&acmeHTTPBind, "acme-http-bind", "", "Address (ex: :80) to answer the HTTP-01 challenge on, otherwise TLS-ALPN-01 is used on the HTTPS port")
+	flags.StringSliceVar(&apiKeys, "api-keys", []string{}, "API keys required to query the API, disabled when none is set")
+	flags.StringVar(&apiKeysFile, "api-keys-file", "", "File with API keys, one per line, in addition to --api-keys")
+	flags.StringVar(&torExitListSource, "tor-exit-list", "", "URL or file of Tor exit node IPs (ex: https://check.torproject.org/torbulkexitlist) flagged with is_tor_exit_node, updated with the databases")
+	flags.IntVar(&bogonStatus, "bogon-status", http.StatusOK, "Status of the responses for private, loopback and reserved IPs: {\"ip\", \"bogon\": true} with 200, a JSON error otherwise (ex: 404 or 422)")
+	flags.StringVar(&notFound, "not-found", NOT_FOUND_EMPTY, "Response for the IPs without a record: 'empty' fields, a '404' JSON error, or 'found' for a \"found\": false field")
+	flags.BoolVar(&resolveHostnames, "resolve-hostnames", false, "Resolve the hostnames looked up in place of IPs (ex: /geoip/example.com)")
+	flags.StringVar(&dnsResolver, "dns-resolver", "", "DNS server (ip:port) resolving the hostnames, the system resolver when empty")
+	flags.DurationVar(&dnsTimeout, "dns-timeout", 2*time.Second, "Timeout of the hostname resolutions")
+	flags.IntVar(&compressMinSize, "compress-min-size", 1024, "Minimum size in bytes of the responses gzipped for the clients accepting it, disabled when 0")
+	flags.StringSliceVar(&compat, "compat", []string{}, "API of another service to also serve, for its clients to switch with only a DNS change: freegeoip, ip-api, ipinfo, ipstack or maxmind, as <name>=<prefix> under a route prefix, can be repeated")
+	flags.BoolVar(&swaggerUI, "swagger-ui", false, "Serve a Swagger UI of the /openapi.json routes document under /docs/")
+	flags.BoolVar(&jsonp, "jsonp", false, "Wrap the JSON responses in a call to ?callback= (JSONP), for clients that cannot use CORS")
+	flags.IntVar(&cacheSize, "cache-size", 0, "Number of decoded records to cache per edition, disabled when 0")
+	flags.StringVar(&redisURL, "redis-url", "", "Redis to share cached records between replicas (ex: redis://localhost:6379/0), disabled when empty")
+	flags.DurationVar(&redisTTL, "redis-ttl", 24*time.Hour, "Expiration of the records cached in Redis")
+	_ = flags.Parse(args)
+	if err := applyEnv(flags); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	if configFile != "" {
+		if err := applyConfigFile(flags, configFile); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	}
+
+	if err := configureLogging(logLevel, logFormat); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	license, err := resolveLicense(license, licenseFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	creds, err := newMaxmindCredentials(accountId, license, secretsSource)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	go creds.refreshEvery(secretsRefresh)
+	if err := setLogIPs(logIPs); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	downloader, err = downloadOptions.downloader()
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	statsd, err = newStatsdClient(statsdAddress, statsdPrefix, statsdTags)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	webhook, err = newWebhookClient(webhookURL, webhookFormat)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	shutdownTracing, err := setupTracing(context.Background())
 	if err != nil {
 		log.Fatal().Err(err).Msg("")
 	}
-	log.Info().Msg("Download finished")
 
-	err = reload(db)
+	if updateRetry.attempts < 1 || updateRetry.delay <= 0 {
+		log.Fatal().Msg("Invalid --update-retries or --update-retry-delay, expected at least 1 attempt and a positive delay")
+	}
+	// Any other status panics in WriteHeader, or has no error body
+	if bogonStatus != http.StatusOK && (bogonStatus < 400 || bogonStatus > 599) {
+		log.Fatal().Msg(fmt.Sprintf("Invalid --bogon-status %d, expected 200 or a 4xx or 5xx status", bogonStatus))
+	}
+
+	schedule, err := newUpdateSchedule(updateInterval, updateScheduleExpr)
 	if err != nil {
 		log.Fatal().Err(err).Msg("")
 	}
-	defer m.db.Close()
 
-	go func() {
-		for {
-			time.Sleep(time.Duration(updateInterval) * time.Hour)
-			db, err := downloadDatabase(edition, accountId, license)
-			if err != nil {
-				log.Error().Err(err).Msg("Downloading update failed")
-				continue
+	if notFound != NOT_FOUND_EMPTY && notFound != NOT_FOUND_ERROR && notFound != NOT_FOUND_FIELD {
+		log.Fatal().Msg(fmt.Sprintf("Invalid --not-found '%s', expected 'empty', '404' or 'found'", notFound))
+	}
+
+	redis, err := newRedisCache(redisURL, redisTTL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+
+	var databases []*maxmind
+	if len(dbPaths) > 0 || len(watchPaths) > 0 {
+		for _, path := range dbPaths {
+			databases = append(databases, &maxmind{path: path, cacheSize: cacheSize, redis: redis, notFound: notFound})
+		}
+		for _, path := range watchPaths {
+			databases = append(databases, &maxmind{path: path, watch: true, cacheSize: cacheSize, redis: redis, notFound: notFound})
+		}
+	} else {
+		for _, edition := range editions {
+			databases = append(databases, &maxmind{
+				edition:      edition,
+				dataDir:      dataDir,
+				keepVersions: keepVersions,
+				cacheSize:    cacheSize,
+				redis:        redis,
+				notFound:     notFound,
+			})
+		}
+	}
+
+	election, err = newDownloadElection(downloadLock, downloadLease)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	if election != nil {
+		if dataDir == "" || len(dbPaths) > 0 || len(watchPaths) > 0 {
+			log.Fatal().Msg("--download-lock and --download-lease need a shared --data-dir to download to")
+		}
+		// Before the databases are loaded, for the first replica to download them
+		election.start()
+	}
+
+	if !lazyStart {
+		accountId, license := creds.get()
+		if err := loadDatabases(databases, accountId, license, schedule.maxAge()); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	}
+
+	torList, err := newTorExitList(torExitListSource, downloader.Client)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+
+	compatPrefixes, err := parseCompat(compat)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	if err := kafkaOpts.validate(); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+
+	tlsConfig, err := loadTLSConfig(tlsCert, tlsKey)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	if http3Enabled && tlsConfig == nil && len(acmeDomains) == 0 {
+		log.Fatal().Msg("--http3 requires --tls-cert or --acme-domains, QUIC being always encrypted")
+	}
+	if http3Enabled && bindUnix != "" {
+		log.Fatal().Msg("--http3 and --bind-unix are mutually exclusive")
+	}
+	if len(acmeDomains) > 0 {
+		if tlsConfig != nil {
+			log.Fatal().Msg("--acme-domains and --tls-cert are mutually exclusive")
+		}
+		// Certificates are validated with the TLS-ALPN-01 challenge on the HTTPS port,
+		// or the HTTP-01 one when --acme-http-bind is set
+		manager := acmeCertManager(acmeDomains, acmeCacheDir, acmeEmail)
+		tlsConfig = hardenTLSConfig(manager.TLSConfig())
+		if acmeHTTPBind != "" {
+			go func() {
+				log.Fatal().Err(http.ListenAndServe(acmeHTTPBind, manager.HTTPHandler(nil))).Msg("")
+			}()
+		}
+	}
+
+	resolver, err := newClientIPResolver(trustedProxies, clientIPHeader)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+
+	apiKeys, err = loadAPIKeys(apiKeys, apiKeysFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	origins, err := newOriginMatcher(allowedOrigins)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	// Reflecting any origin with the credentials would let any website read the responses as its visitors
+	if corsAllowCredentials && origins.any {
+		log.Fatal().Msg("--cors-allow-credentials requires explicit --allowed-origins, not '*'")
+	}
+	cors := &corsPolicy{
+		originMatcher:    origins,
+		allowCredentials: corsAllowCredentials,
+		exposeHeaders:    corsExposeHeaders,
+		varyOrigin:       corsVaryOrigin,
+	}
+	// apiMethodsRoute wraps the handlers of the API routes allowing methods, authenticated when API keys are
+	// configured, and shed under load. apiRoute is the one of the GET routes.
+	shedder := newLoadShedder(maxConcurrent, maxQueued, queueTimeout)
+	apiMethodsRoute := func(route string, methods string, handle httprouter.Handle) httprouter.Handle {
+		handle = apiKeyMiddleware(handle, apiKeys)
+		if jsonp {
+			handle = jsonpMiddleware(handle)
+		}
+		handle = compressionMiddleware(handle, compressMinSize)
+		return metricsMiddleware(route, headersMiddleware(shedder.middleware(route, handle), cors, methods))
+	}
+	apiRoute := func(route string, handle httprouter.Handle) httprouter.Handle {
+		return apiMethodsRoute(route, "GET", handle)
+	}
+
+	var hostnames *hostnameResolver
+	if resolveHostnames {
+		hostnames = newHostnameResolver(dnsResolver, dnsTimeout)
+	}
+
+	// The lookups are cacheable by browsers and CDNs until the next update check (a day when disabled)
+	cacheMaxAge := schedule.period()
+	if cacheMaxAge == 0 {
+		cacheMaxAge = 24 * time.Hour
+	}
+	cacheable := func(handle httprouter.Handle) httprouter.Handle {
+		return httpCacheMiddleware(handle, databases, cacheMaxAge, resolver, len(apiKeys) > 0)
+	}
+	readiness := metricsMiddleware("/readyz", readinessHandler(databases, time.Duration(readyMaxAge)*24*time.Hour, readyMaxUpdateAge))
+
+	// The routes depend on the loaded databases, until then (with --lazy-start) only the health checks are served
+	mainHandler := newLazyHandler(readiness)
+	servers := []*http.Server{{Handler: mainHandler, TLSConfig: tlsConfig}}
+	// The addresses of the servers, the main one sharing its router between every --bind
+	serverBinds := [][]bindAddress{parseBinds(binds)}
+	if len(binds) == 0 {
+		serverBinds[0] = []bindAddress{{network: "tcp", address: net.JoinHostPort(bindIP, bindPort)}}
+	}
+	// The expvar variables include the command line, and so --license
+	if debug && adminBind == "" {
+		log.Fatal().Msg("--debug requires --admin-bind, not to serve the profiles and the command line on the main port")
+	}
+	if adminBind == "" && len(apiKeys) == 0 {
+		log.Info().Msg("The admin routes (/admin/) are not served, they need --admin-bind or --api-keys")
+	}
+	var adminHandler *lazyHandler
+	if adminBind != "" {
+		adminHandler = newLazyHandler(readiness)
+		servers = append(servers, &http.Server{Handler: adminHandler, TLSConfig: tlsConfig})
+		serverBinds = append(serverBinds, []bindAddress{{network: "tcp", address: adminBind}})
+	}
+	for _, server := range servers {
+		serverOpts.apply(server)
+	}
+	websockets := newWebsocketStreams()
+
+	// Handled once the databases are loaded, not to exit on a SIGHUP while loading
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	var grpcServer atomic.Pointer[grpc.Server]
+	// The Kafka enrichment stops on shutdown, finishing its batch
+	kafkaCtx, stopKafka := context.WithCancel(context.Background())
+	var kafkaConsumers sync.WaitGroup
+	// serveDatabases serves the routes of the loaded databases and keeps them up to date
+	serveDatabases := func() {
+		for _, m := range databases {
+			m.registerAgeMetrics()
+		}
+		if err := watchDatabases(databases); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+		if election != nil {
+			go followSharedDatabases(databases, creds, followInterval)
+		}
+
+		go func() {
+			for schedule.wait() {
+				for _, m := range databases {
+					m.update(creds.get())
+				}
+				if torList != nil {
+					if err := torList.update(); err != nil {
+						log.Error().Err(err).Msg("")
+					}
+				}
+			}
+		}()
+
+		// Like the periodic update, on SIGHUP (ex: after geoipupdate replaced the --db-path files)
+		go func() {
+			for range hangup {
+				log.Info().Msg("SIGHUP received, updating databases")
+				for _, m := range databases {
+					m.update(creds.get())
+				}
+				if torList != nil {
+					if err := torList.update(); err != nil {
+						log.Error().Err(err).Msg("")
+					}
+				}
+			}
+		}()
+
+		defaultLookup, lookups := buildLookups(databases, torList, bogonStatus)
+
+		prefixRoutes := map[string]httprouter.Handle{}
+		for name, lookup := range lookups {
+			prefixRoutes[name] = apiRoute(prefix+"/"+name+"/:ip", cacheable(lookupHandler(lookup, resolver, hostnames)))
+		}
+		// Not shed as the other API routes, a stream would hold its slot for as long as it is open
+		prefixRoutes["ws"] = metricsMiddleware(prefix+"/ws", headersMiddleware(apiKeyMiddleware(websocketHandler(defaultLookup, cors, websockets), apiKeys), cors, "GET"))
+		prefixHandler := prefixRouter(
+			prefixRoutes,
+			apiRoute(prefix+"/:ip", cacheable(lookupHandler(defaultLookup, resolver, hostnames))),
+			apiRoute(prefix+"/:ip/:field", cacheable(fieldHandler(defaultLookup, resolver, hostnames))),
+		)
+
+		grpcServer.Store(newGRPCServer(lookups, defaultLookup, tlsConfig, apiKeys))
+		if grpcPort != "" {
+			go func() {
+				log.Fatal().Err(serveGRPC(grpcServer.Load(), net.JoinHostPort(bindIP, grpcPort))).Msg("")
+			}()
+		}
+
+		// The DNS, whois and Kafka records have the ASN, from the full lookup adding it to the City one when both are
+		// loaded
+		textLookup := defaultLookup
+		if full, ok := lookups["full"]; ok {
+			textLookup = full
+		}
+		if dnsPort != "" {
+			go func() {
+				log.Fatal().Err(serveDNS(newDNSServer(dnsZone, textLookup), net.JoinHostPort(bindIP, dnsPort))).Msg("")
+			}()
+		}
+		if whoisEnabled {
+			go func() {
+				log.Fatal().Err(serveWhois(&whoisServer{lookup: textLookup}, net.JoinHostPort(bindIP, whoisPort))).Msg("")
+			}()
+		}
+		if kafkaOpts.enabled() {
+			enricher := newKafkaEnricher(kafkaOpts, textLookup)
+			kafkaConsumers.Add(1)
+			go func() {
+				defer kafkaConsumers.Done()
+				if err := enricher.run(kafkaCtx); err != nil {
+					log.Fatal().Err(err).Msg("")
+				}
+			}()
+		}
+
+		router := newRouter()
+		// The same methods as the preflight of the route, also the one of prefix+"/:ip"
+		batch := apiMethodsRoute(prefix+"/batch", "GET, POST, OPTIONS", batchHandler(defaultLookup, batchMaxSize))
+		clientIP := apiRoute("/ip", ipHandler(resolver))
+		// A future response shape ships under /v2, the unversioned routes staying the ones of /v1
+		for _, version := range []string{"", "/" + API_VERSION} {
+			router.GET(version+prefix, prefixHandler)
+			router.GET(version+prefix+"/:ip", prefixHandler)
+			router.GET(version+prefix+"/:ip/:arg", prefixHandler)
+			router.POST(version+prefix+"/batch", batch)
+			router.GET(version+"/ip", clientIP)
+			router.OPTIONS(version+prefix, preflightHandler(cors, "GET, OPTIONS"))
+			router.OPTIONS(version+prefix+"/:ip", preflightHandler(cors, "GET, POST, OPTIONS"))
+			router.OPTIONS(version+prefix+"/:ip/:arg", preflightHandler(cors, "GET, OPTIONS"))
+			router.OPTIONS(version+"/ip", preflightHandler(cors, "GET, OPTIONS"))
+		}
+		router.GET("/healthz", metricsMiddleware("/healthz", healthCheckHandler))
+		router.GET("/livez", metricsMiddleware("/livez", healthCheckHandler))
+		router.GET("/readyz", readiness)
+		router.GET("/dbinfo", metricsMiddleware("/dbinfo", dbInfoHandler(databases)))
+		router.GET("/metrics", metricsHandler())
+		if len(compatPrefixes) > 0 {
+			cityDB, cityLookup := compatCity(databases, lookups)
+			if cityDB == nil {
+				log.Fatal().Msg("--compat requires a City edition")
 			}
-			log.Info().Msg("Download finished")
-			err = reload(db)
+			compat, err := compatRouter(compatPrefixes, &compatContext{
+				lookup:    cityLookup,
+				city:      cityDB,
+				asn:       lookups["asn"],
+				resolver:  resolver,
+				hostnames: hostnames,
+				apiKeys:   apiKeys,
+				apiRoute:  apiRoute,
+			})
 			if err != nil {
-				log.Error().Err(err).Msg("Reload failed")
+				log.Fatal().Err(err).Msg("")
 			}
+			router.NotFound = compat
 		}
-	}()
 
-	router := httprouter.New()
-	router.GET(prefix, headersMiddleware(geoHandler, allowedOrigins))
-	router.GET(prefix + "/:ip", headersMiddleware(geoHandler, allowedOrigins))
-	router.GET("/healthz", healthCheckHandler)
+		lookupNames := make([]string, 0, len(lookups))
+		for name := range lookups {
+			lookupNames = append(lookupNames, name)
+		}
+		openAPI := openAPIDocument(databases, lookupNames, openAPIOptions{
+			version:      "/" + API_VERSION,
+			prefix:       prefix,
+			batchMaxSize: batchMaxSize,
+			jsonp:        jsonp,
+			hostnames:    resolveHostnames,
+			apiKeys:      len(apiKeys) > 0,
+			admin:        adminBind == "" && len(apiKeys) > 0,
+		})
+		router.GET("/openapi.json", metricsMiddleware("/openapi.json", headersMiddleware(openAPIHandler(openAPI), cors, "GET")))
+		if swaggerUI {
+			router.GET("/docs/*path", metricsMiddleware("/docs", swaggerUIHandler()))
+		}
+
+		// On the main port only when authenticated, as they download the databases with the Maxmind quota
+		var adminRouter *httprouter.Router
+		switch {
+		case adminBind != "":
+			adminRouter = newRouter()
+		case len(apiKeys) > 0:
+			adminRouter = router
+		}
+		if adminRouter != nil {
+			adminRouter.POST("/admin/reload", metricsMiddleware("/admin/reload", apiKeyMiddleware(reloadHandler(databases, creds), apiKeys)))
+			adminRouter.POST("/admin/rollback", metricsMiddleware("/admin/rollback", apiKeyMiddleware(rollbackHandler(databases), apiKeys)))
+			adminRouter.GET("/admin/update-status", metricsMiddleware("/admin/update-status", apiKeyMiddleware(updateStatusHandler(databases, schedule), apiKeys)))
+			adminRouter.GET("/admin/cache-stats", metricsMiddleware("/admin/cache-stats", apiKeyMiddleware(cacheStatsHandler(databases), apiKeys)))
+		}
+		if debug {
+			adminRouter.GET("/debug/pprof/*profile", apiKeyMiddleware(debugHandler(), apiKeys))
+			adminRouter.POST("/debug/pprof/*profile", apiKeyMiddleware(debugHandler(), apiKeys))
+			adminRouter.GET("/debug/vars", apiKeyMiddleware(debugHandler(), apiKeys))
+		}
+		mainHandler.serve(router)
+		if adminHandler != nil {
+			adminHandler.serve(adminRouter)
+		}
+	}
+	if !lazyStart {
+		serveDatabases()
+	}
+
+	// The spans of the requests are children of the caller's ones, named by metricsMiddleware after their route
+	for _, server := range servers {
+		server.Handler = recoveryMiddleware(otelhttp.NewHandler(server.Handler, "HTTP"))
+	}
+
+	// With TLS, HTTP/2 is negotiated by net/http already. h2c is with prior knowledge, as used by gRPC and Envoy.
+	if h2cEnabled {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		for _, server := range servers {
+			server.Protocols = protocols
+		}
+	}
 
-	log.Fatal().Err(http.ListenAndServe(bindIP+":"+bindPort, router)).Msg("")
+	// The servers without a listener listen on their addresses. Sockets passed by systemd are used by the main server,
+	// then the admin one. All of them are limited to --max-connections.
+	listeners := make([][]net.Listener, len(servers))
+	activated, err := systemdListeners()
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	if len(activated) > len(servers) {
+		log.Fatal().Msg(fmt.Sprintf("%d sockets passed by systemd, at most %d expected", len(activated), len(servers)))
+	}
+	for i, listener := range activated {
+		listeners[i] = []net.Listener{listener}
+		log.Info().Msg(fmt.Sprintf("Listening on the socket passed by systemd '%s'", listener.Addr()))
+	}
+	if bindUnix != "" && listeners[0] == nil {
+		listener, err := listenUnix(bindUnix, bindUnixMode, bindUnixOwner)
+		if err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+		listeners[0] = []net.Listener{listener}
+		log.Info().Msg(fmt.Sprintf("Listening on '%s'", bindUnix))
+	}
+	for i := range servers {
+		listeners[i], err = serverOpts.listen(listeners[i], serverBinds[i])
+		if err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	}
+
+	// The API is also served over QUIC on the same ports in UDP, advertised by the TCP responses
+	var http3Server *http3.Server
+	if http3Enabled {
+		http3Server = newHTTP3Server(servers[0].Handler, tlsConfig, serverOpts)
+		servers[0].Handler = altSvcMiddleware(servers[0].Handler, http3Server)
+		if err := listenHTTP3(http3Server, serverBinds[0]); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	}
+
+	for i, server := range servers {
+		for _, listener := range listeners[i] {
+			go func() {
+				var err error
+				// Not server.TLSConfig, set by the HTTP/2 setup of the first Serve
+				if tlsConfig != nil {
+					// The certificate is already loaded in the TLSConfig
+					err = server.ServeTLS(listener, "", "")
+				} else {
+					err = server.Serve(listener)
+				}
+				if err != http.ErrServerClosed {
+					log.Fatal().Err(err).Msg("")
+				}
+			}()
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	if lazyStart {
+		go func() {
+			if err := loadDatabasesWithRetries(ctx, databases, creds, schedule.maxAge()); err != nil {
+				return
+			}
+			log.Info().Msg("Databases loaded, serving the lookups")
+			serveDatabases()
+		}()
+	}
+	<-ctx.Done()
+	stop()
+
+	log.Info().Msg(fmt.Sprintf("Shutting down, draining in-flight requests for up to %s", shutdownTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	stopKafka()
+	// Not tracked by Shutdown once hijacked
+	websockets.closeAll()
+	kafkaStopped := make(chan struct{})
+	go func() {
+		kafkaConsumers.Wait()
+		close(kafkaStopped)
+	}()
+	grpcStopped := make(chan struct{})
+	go func() {
+		if server := grpcServer.Load(); server != nil {
+			server.GracefulStop()
+		}
+		close(grpcStopped)
+	}()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("Shutdown did not finish in time")
+		}
+	}
+	if http3Server != nil {
+		if err := http3Server.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("Shutdown did not finish in time")
+		}
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		if server := grpcServer.Load(); server != nil {
+			server.Stop()
+		}
+	}
+	select {
+	case <-kafkaStopped:
+	case <-ctx.Done():
+		log.Error().Msg("The Kafka enrichment did not stop in time, its last batch will be enriched again")
+	}
+
+	for _, m := range databases {
+		m.close()
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("Flushing the traces failed")
+	}
+	log.Info().Msg("Shutdown finished")
 }
 
-func healthCheckHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	w.WriteHeader(http.StatusOK)
-	return
+// loadDatabases fetches and loads the databases at startup, saved copies younger than maxAge are reused
+func loadDatabases(databases []*maxmind, accountId string, license string, maxAge time.Duration) error {
+	loaded := map[string]bool{}
+	for _, m := range databases {
+		// Already loaded by a previous attempt of loadDatabasesWithRetries
+		if m.readiness().Loaded {
+			loaded[m.edition] = true
+			continue
+		}
+
+		start := time.Now()
+		ctx, span := startSpan(context.Background(), "database load", m.edition)
+		db, err := m.fetchAtStartup(ctx, accountId, license, maxAge)
+		if err == nil {
+			err = m.tracedReload(ctx, db)
+		}
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+
+		if m.edition == "" {
+			m.edition = m.db.Metadata().DatabaseType
+		}
+		if loaded[m.edition] {
+			return fmt.Errorf("edition '%s' is loaded more than once", m.edition)
+		}
+		loaded[m.edition] = true
+		m.recordUpdate()
+		m.recordAttempt(start, "loaded", nil)
+	}
+	return nil
 }
 
-func originIsAllowed(origin string, allowedOrigins []string) bool {
-	if len(allowedOrigins) == 1 && allowedOrigins[0] == "*" {
-		return true
+// buildLookups returns the lookup of the default routes and the named ones: every edition, "asn", "country" and
+// "full", with the city responses enriched by the other databases
+func buildLookups(databases []*maxmind, torList *torExitList, bogonStatus int) (lookupFunc, map[string]lookupFunc) {
+	// The city responses are enriched with the other databases
+	var enrichers []enrichFunc
+	for _, m := range databases {
+		if m.isAnonymousIP() {
+			enrichers = append(enrichers, m.enrichAnonymousIP)
+			break
+		}
+	}
+	for _, m := range databases {
+		if m.isISP() {
+			enrichers = append(enrichers, m.enrichISP)
+			break
+		}
+	}
+	for _, m := range databases {
+		if m.isDomain() {
+			enrichers = append(enrichers, m.enrichDomain)
+			break
+		}
+	}
+	if torList != nil {
+		enrichers = append(enrichers, torList.enrich)
 	}
 
-	for _, allowedOrigin := range allowedOrigins {
-		if origin == allowedOrigin {
-			return true
+	// The first database serves the default routes, every edition is also available under its own name
+	defaultLookup := enrichedLookup(databases[0].lookup(), enrichers)
+	lookups := map[string]lookupFunc{}
+	var countryDB *maxmind
+	for _, m := range databases {
+		lookups[m.edition] = enrichedLookup(m.lookup(), enrichers)
+		if _, ok := lookups["asn"]; !ok && m.isASN() {
+			lookups["asn"] = m.lookupASN
+		}
+		// Country editions are smaller, otherwise the country is read from the first city database
+		if m.isCity() && (countryDB == nil || !countryDB.isCountryEdition() && m.isCountryEdition()) {
+			countryDB = m
 		}
 	}
-	return false
+	if countryDB != nil {
+		lookups["country"] = countryDB.lookupCountry
+	}
+	// The full route merges every database into the response of the first city one, including the ASN edition
+	if len(databases) > 1 {
+		for _, m := range databases {
+			if m.isCity() {
+				fullEnrichers := append([]enrichFunc{}, enrichers...)
+				for _, asnDB := range databases {
+					if asnDB.isASN() && !asnDB.isISP() {
+						fullEnrichers = append(fullEnrichers, asnDB.enrichASN)
+						break
+					}
+				}
+				lookups["full"] = enrichedLookup(m.lookup(), fullEnrichers)
+				break
+			}
+		}
+	}
+
+	defaultLookup = bogonLookup(defaultLookup, bogonStatus)
+	for name, lookup := range lookups {
+		lookups[name] = bogonLookup(lookup, bogonStatus)
+	}
+	return defaultLookup, lookups
 }
 
-func headersMiddleware(next httprouter.Handle, allowedOrigins []string) httprouter.Handle {
+// prefixRouter dispatches the requests under the route prefix: "/<prefix>/<name>/<ip>" and "/<prefix>/<name>" go
+// to the named route, "/<prefix>/<ip>/<field>" to fieldHandle and anything else to defaultHandle. httprouter does not
+// allow registering static segments next to the ":ip" wildcard, hence this second level of routing.
+func prefixRouter(routes map[string]httprouter.Handle, defaultHandle httprouter.Handle, fieldHandle httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		w.Header().Set("Content-Type", "application/json")
+		if route, ok := routes[ps.ByName("ip")]; ok {
+			route(w, r, httprouter.Params{{Key: "ip", Value: ps.ByName("arg")}})
+			return
+		}
 
-		origin := r.Header.Get("Origin")
-		if originIsAllowed(origin, allowedOrigins) {
-			w.Header().Set("Access-Control-Allow-Methods", "GET")
-			w.Header().Set("Access-Control-Allow-Origin", origin)
+		if field := ps.ByName("arg"); field != "" {
+			fieldHandle(w, r, httprouter.Params{{Key: "ip", Value: ps.ByName("ip")}, {Key: "field", Value: field}})
+			return
 		}
 
-		next(w, r, ps)
+		defaultHandle(w, r, ps)
 	}
 }
 
-func errResponse(w http.ResponseWriter, statusCode int, errStr string) {
-	w.WriteHeader(statusCode)
-	_, err := w.Write([]byte(`{"error": "` + errStr + `"}`))
-	if err != nil {
-		log.Error().Err(err).Msg("")
+func healthCheckHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.WriteHeader(http.StatusOK)
+	return
+}
+
+// headersMiddleware sets the JSON content type and the CORS headers of the responses, with the methods of the route
+func headersMiddleware(next httprouter.Handle, cors *corsPolicy, methods string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if cors.allowOrigin(w, r) {
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if len(cors.exposeHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(cors.exposeHeaders, ", "))
+			}
+		}
+
+		next(w, r, ps)
 	}
 }
 
-func geoResponse(w http.ResponseWriter, geo geoResponseStruct) {
+func geoResponse(w http.ResponseWriter, geo interface{}) {
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
 	j, err := json.Marshal(geo)
 	if err != nil {
-		errResponse(w, http.StatusInternalServerError, "")
+		errResponse(w, http.StatusInternalServerError, ERR_INTERNAL, "")
 		return
 	}
 	_, err = w.Write(j)
@@ -152,107 +992,481 @@ func geoResponse(w http.ResponseWriter, geo geoResponseStruct) {
 	}
 }
 
-func getClientIP(request *http.Request) string {
-	ip := request.Header.Get("X-Real-IP")
+// requestIP returns the IP to look up: the one in the route or else the client IP. With hostnames, a hostname in the
+// route is resolved (?family=ipv4 or ipv6 to choose) and returned with its address.
+// When it is invalid the error response is written and ip is nil.
+func requestIP(
+	w http.ResponseWriter,
+	request *http.Request,
+	ps httprouter.Params,
+	resolver *clientIPResolver,
+	hostnames *hostnameResolver,
+) (ipStr string, ip net.IP, hostname string) {
+	ipStr = ps.ByName("ip")
 
-	if ip == "" {
-		ip = request.Header.Get("X-Forwarded-For")
+	if ipStr == "" {
+		ipStr = resolver.clientIP(request)
+	}
+
+	if hostnames != nil && net.ParseIP(ipStr) == nil && hostnamePattern.MatchString(ipStr) {
+		hostname = ipStr
+		resolved, err := hostnames.resolve(request.Context(), hostname, request.URL.Query().Get("family"))
+		if err != nil {
+			log.Info().Err(err).Msg(fmt.Sprintf("Resolving '%s' failed", hostname))
+			errResponse(w, http.StatusBadRequest, ERR_HOSTNAME_UNRESOLVED, "Hostname could not be resolved")
+			return ipStr, nil, hostname
+		}
+		ipStr = resolved.String()
 	}
 
-	if ip == "" {
-		ip = request.RemoteAddr
+	ip = net.ParseIP(ipStr)
+	if ip == nil {
+		log.Info().Msg(fmt.Sprintf("Invalid IP: '%s'", logIP(ipStr)))
+		errResponse(w, http.StatusBadRequest, ERR_INVALID_IP, "Invalid IP address")
 	}
+	return ipStr, ip, hostname
+}
+
+// lookupFunc decodes the record of an IP into the response served by a route, with the names in the first of langs
+// available. ctx is the one of the request, bounding the reads of the Redis cache.
+type lookupFunc func(ctx context.Context, ipStr string, ip net.IP, langs []string) (interface{}, error)
 
-	parts := strings.Split(ip, ",")
+// lookupStatusError is a lookup error served with its status and code, instead of a 500
+type lookupStatusError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e lookupStatusError) Error() string {
+	return e.message
+}
 
-	if len(parts) == 0 {
-		return ""
+// lookupError returns the status, code and message to serve for a lookup error
+func lookupError(err error) (int, string, string) {
+	var statusErr lookupStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status, statusErr.code, statusErr.message
 	}
-	
-	firstElement := strings.TrimSpace(parts[0])
-	return firstElement
+	log.Err(err).Msg("Lookup error")
+	return http.StatusInternalServerError, ERR_LOOKUP_FAILED, "Lookup error"
 }
 
-func geoHandler(w http.ResponseWriter, request *http.Request, ps httprouter.Params) {
-	ipStr := ps.ByName("ip")
+// lookup returns the lookup matching the type of the database
+func (m *maxmind) lookup() lookupFunc {
+	if m.isISP() {
+		return m.lookupISP
+	}
+	if m.isASN() && !m.isCity() {
+		return m.lookupASN
+	}
+	if m.isAnonymousIP() {
+		return m.lookupAnonymousIP
+	}
+	if m.isDomain() {
+		return m.lookupDomain
+	}
+	if m.isEnterprise() {
+		return m.lookupEnterprise
+	}
+	return m.lookupCity
+}
 
-	if ipStr == "" {
-		ipStr = getClientIP(request)
+func lookupHandler(lookup lookupFunc, resolver *clientIPResolver, hostnames *hostnameResolver) httprouter.Handle {
+	return func(w http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+		ipStr, ip, hostname := requestIP(w, request, ps, resolver, hostnames)
+		if ip == nil {
+			return
+		}
+		langs := requestLanguages(request)
+		w.Header().Add("Vary", "Accept-Language")
+
+		log.Info().Msg(fmt.Sprintf("Looking up IP '%s'", logIP(ipStr)))
+
+		resp, err := lookup(request.Context(), ipStr, ip, langs)
+		if err != nil {
+			status, code, message := lookupError(err)
+			errResponse(w, status, code, message)
+			return
+		}
+		// The bogon responses have none of the lookup fields, they are answered with those they have
+		_, bogon := resp.(bogonResponseStruct)
+		if hostname != "" {
+			resp = hostnameResponse{hostname: hostname, resp: resp}
+		}
+
+		resp, unknown, err := selectFields(resp, requestFields(request))
+		if err != nil {
+			errResponse(w, http.StatusInternalServerError, ERR_INTERNAL, "")
+			return
+		}
+		if len(unknown) > 0 && !bogon {
+			errResponse(w, http.StatusBadRequest, ERR_UNKNOWN_FIELD, unknownFieldsMessage(unknown))
+			return
+		}
+		formatResponse(w, request, resp)
+	}
+}
+
+type batchErrorStruct struct {
+	IP    string `json:"ip"`
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// batchHandler looks up a JSON array of at most maxSize IPs, responding with the results in the same order
+func batchHandler(lookup lookupFunc, maxSize int) httprouter.Handle {
+	return func(w http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+		var json = jsoniter.ConfigCompatibleWithStandardLibrary
+		var ips []string
+		// An IPv6 is at most 45 characters, plus the quotes, comma and some whitespace
+		body := http.MaxBytesReader(w, request.Body, int64(maxSize)*64+1024)
+		if err := json.NewDecoder(body).Decode(&ips); err != nil {
+			log.Info().Err(err).Msg("Invalid batch body")
+			errResponse(w, http.StatusBadRequest, ERR_INVALID_BATCH, "Expected a JSON array of IP addresses")
+			return
+		}
+		if len(ips) > maxSize {
+			errResponse(w, http.StatusRequestEntityTooLarge, ERR_BATCH_TOO_LARGE, fmt.Sprintf("At most %d IP addresses per batch", maxSize))
+			return
+		}
+
+		log.Info().Msg(fmt.Sprintf("Looking up batch of %d IPs", len(ips)))
+
+		fields := requestFields(request)
+		langs := requestLanguages(request)
+		results := make([]interface{}, len(ips))
+		for i, ipStr := range ips {
+			results[i] = batchResult(request.Context(), lookup, ipStr, langs, fields)
+		}
+
+		formatResponse(w, request, results)
 	}
-	
+}
+
+// batchResult is the response of one IP of a batch, failures are a batchErrorStruct instead of failing the batch
+func batchResult(ctx context.Context, lookup lookupFunc, ipStr string, langs []string, fields []string) interface{} {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		log.Info().Msg(fmt.Sprintf("Invalid IP: '%s'", ipStr))
-		errResponse(w, http.StatusBadRequest, "Invalid IP address")
-		return
+		return batchErrorStruct{IP: ipStr, Error: "Invalid IP address", Code: ERR_INVALID_IP}
 	}
-	
-	log.Info().Msg(fmt.Sprintf("Looking up IP '%s'", ipStr))
 
-	m.mutex.RLock()
-	geo, err := m.db.City(ip)
-	m.mutex.RUnlock()
+	resp, err := lookup(ctx, ipStr, ip, langs)
 	if err != nil {
-		log.Err(err).Msg("Lookup error")
-		errResponse(w, http.StatusInternalServerError, "Lookup error")
-		return
+		_, code, message := lookupError(err)
+		return batchErrorStruct{IP: ipStr, Error: message, Code: code}
+	}
+	_, bogon := resp.(bogonResponseStruct)
+	resp, unknown, err := selectFields(resp, fields)
+	if err != nil {
+		return batchErrorStruct{IP: ipStr, Error: "Lookup error", Code: ERR_LOOKUP_FAILED}
+	}
+	if len(unknown) > 0 && !bogon {
+		return batchErrorStruct{IP: ipStr, Error: unknownFieldsMessage(unknown), Code: ERR_UNKNOWN_FIELD}
+	}
+	return resp
+}
+
+func (m *maxmind) lookupASN(ctx context.Context, ipStr string, ip net.IP, _ []string) (interface{}, error) {
+	network, found, err := m.match(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	record, err := m.record(ctx, "asn", ip, func(db *sharedReader) (interface{}, error) {
+		return db.ASN(ip)
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return nil, err
 	}
+	asn := record.(*geoip2.ASN)
+
+	return asnResponseStruct{
+		IP:           ipStr,
+		ASN:          asn.AutonomousSystemNumber,
+		Organization: asn.AutonomousSystemOrganization,
+		Network:      network,
+		Found:        found,
+	}, nil
+}
+
+// lookupCountry only decodes the country of the record, faster than a city lookup for geo-blocking
+func (m *maxmind) lookupCountry(ctx context.Context, ipStr string, ip net.IP, langs []string) (interface{}, error) {
+	network, found, err := m.match(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	record, err := m.record(ctx, "country", ip, func(db *sharedReader) (interface{}, error) {
+		return db.Country(ip)
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return nil, err
+	}
+	geo := record.(*geoip2.Country)
+
+	return countryResponseStruct{
+		IP:          ipStr,
+		CountryCode: geo.Country.IsoCode,
+		CountryName: localizedName(geo.Country.Names, langs),
+
+		IsInEuropeanUnion: geo.Country.IsInEuropeanUnion,
+		Network:           network,
+		Found:             found,
+	}, nil
+}
+
+func (m *maxmind) lookupCity(ctx context.Context, ipStr string, ip net.IP, langs []string) (interface{}, error) {
+	network, found, err := m.match(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	record, err := m.record(ctx, "city", ip, func(db *sharedReader) (interface{}, error) {
+		return db.City(ip)
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return nil, err
+	}
+	resp := cityResponse(ipStr, record.(*geoip2.City), langs)
+	resp.Network = network
+	resp.Found = found
+	return resp, nil
+}
+
+// cityResponse builds the response of a city record, with the names in the first of langs available
+func cityResponse(ipStr string, geo *geoip2.City, langs []string) geoResponseStruct {
 
 	stateName := ""
 	stateCode := ""
+	var stateGeonameID uint
 	if len(geo.Subdivisions) > 0 {
-		stateName = geo.Subdivisions[0].Names["en"]
+		stateName = localizedName(geo.Subdivisions[0].Names, langs)
 		stateCode = geo.Subdivisions[0].IsoCode
+		stateGeonameID = geo.Subdivisions[0].GeoNameID
+	}
+	subdivisions := make([]subdivisionStruct, len(geo.Subdivisions))
+	for i, subdivision := range geo.Subdivisions {
+		subdivisions[i] = subdivisionStruct{
+			Code:      subdivision.IsoCode,
+			Name:      localizedName(subdivision.Names, langs),
+			GeonameID: subdivision.GeoNameID,
+		}
 	}
-	resp := geoResponseStruct{
-		IP:		  ipStr,
+	return geoResponseStruct{
+		IP:          ipStr,
 		CountryCode: geo.Country.IsoCode,
-		CountryName: geo.Country.Names["en"],
-		Continent:   geo.Continent.Names["en"],
+		CountryName: localizedName(geo.Country.Names, langs),
+		Continent:   localizedName(geo.Continent.Names, langs),
 		StateCode:   stateCode,
 		StateName:   stateName,
-		CityName:	geo.City.Names["en"],
+		CityName:    localizedName(geo.City.Names, langs),
 		PostalCode:  geo.Postal.Code,
-		Latitude:	geo.Location.Latitude,
+		Latitude:    geo.Location.Latitude,
 		Longitude:   geo.Location.Longitude,
-		TimeZone:	geo.Location.TimeZone,
+		TimeZone:    geo.Location.TimeZone,
+		MetroCode:   int(geo.Location.MetroCode),
+
+		AccuracyRadius:   geo.Location.AccuracyRadius,
+		ContinentCode:    geo.Continent.Code,
+		CountryGeonameID: geo.Country.GeoNameID,
+		StateGeonameID:   stateGeonameID,
+		CityGeonameID:    geo.City.GeoNameID,
+		Subdivisions:     subdivisions,
+
+		IsInEuropeanUnion: geo.Country.IsInEuropeanUnion,
+		RegisteredCountry: countryStruct{
+			Code:              geo.RegisteredCountry.IsoCode,
+			Name:              localizedName(geo.RegisteredCountry.Names, langs),
+			GeonameID:         geo.RegisteredCountry.GeoNameID,
+			IsInEuropeanUnion: geo.RegisteredCountry.IsInEuropeanUnion,
+		},
+		RepresentedCountry: countryStruct{
+			Code:              geo.RepresentedCountry.IsoCode,
+			Name:              localizedName(geo.RepresentedCountry.Names, langs),
+			GeonameID:         geo.RepresentedCountry.GeoNameID,
+			IsInEuropeanUnion: geo.RepresentedCountry.IsInEuropeanUnion,
+			Type:              geo.RepresentedCountry.Type,
+		},
 	}
+}
+
+// update fetches the database and hot swaps it when it changed, logging and recording the outcome
+func (m *maxmind) update(accountId string, license string) {
+	m.updating.Lock()
+	defer m.updating.Unlock()
+	m.updateLocked(accountId, license)
+}
 
-	geoResponse(w, resp)
+// updateLocked is update, with m.updating held by the caller
+func (m *maxmind) updateLocked(accountId string, license string) {
+	start := time.Now()
+	ctx, span := startSpan(context.Background(), "database update", m.edition)
+	db, err := m.fetchWithRetries(ctx, accountId, license)
+	result := "failed"
+	defer func() { endUpdateSpan(span, result, err) }()
+	if errors.Is(err, geoip.ErrNotModified) {
+		result = "not_modified"
+		log.Info().Msg(fmt.Sprintf("Database is up to date (edition: '%s')", m.edition))
+		databaseLastUpdate.WithLabelValues(m.edition).SetToCurrentTime()
+		m.recordAttemptResult("not_modified")
+		m.recordAttempt(start, "not_modified", nil)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg(fmt.Sprintf("Fetching update failed (edition: '%s')", m.edition))
+		databaseUpdateErrorsTotal.WithLabelValues(m.edition).Inc()
+		m.recordAttemptResult("failed")
+		statsd.count("database.update_errors", "edition:"+m.edition)
+		m.recordAttempt(start, "failed", err)
+		return
+	}
+
+	oldBuildEpoch := m.buildEpoch()
+	err = m.tracedReload(ctx, db)
+	if err != nil {
+		log.Error().Err(err).Msg(fmt.Sprintf("Reload failed (edition: '%s')", m.edition))
+		databaseUpdateErrorsTotal.WithLabelValues(m.edition).Inc()
+		statsd.count("database.update_errors", "edition:"+m.edition)
+		m.recordAttemptResult("failed")
+		m.recordAttempt(start, "failed", err)
+		return
+	}
+	result = "updated"
+	m.recordUpdate()
+	m.recordAttemptResult("updated")
+	m.recordAttempt(start, "updated", nil)
+	// By the downloading replica only, not once per replica
+	if election.leader() {
+		m.notifyChange("updated", oldBuildEpoch)
+	}
 }
 
-func downloadDatabase(edition string, accountId string, license string) ([]byte, error) {
-	url := fmt.Sprintf(URL_TEMPLATE, edition)
+// fetchedDatabase is a database file, memory-mapped once opened: the OS pages it in on demand, and the processes
+// opening the same file share it in the page cache
+type fetchedDatabase struct {
+	path string
+	// Whether path is a temporary file, removed once opened
+	temporary bool
+	md5       string
+	// The database already opened and checked when downloaded to the data directory, swapped in as is
+	opened *geoip.Database
+}
 
-	log.Info().Msg(fmt.Sprintf("Starting database download (edition: '%s')", edition))
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+// readDatabase is the database of a file, ex: of --db-path or the data directory
+func readDatabase(path string) (*fetchedDatabase, error) {
+	sum, err := geoip.FileMD5(path)
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(accountId, license)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	return &fetchedDatabase{path: path, md5: sum}, nil
+}
+
+// fetchFile is the database of a file, geoip.ErrNotModified when it is the loaded one
+func fetchFile(ctx context.Context, edition string, path string, currentMD5 string) (*fetchedDatabase, error) {
+	path, sum, err := downloader.FetchFile(ctx, edition, path, "", "", currentMD5, "")
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	gzr, err := gzip.NewReader(resp.Body)
+	return &fetchedDatabase{path: path, md5: sum}, nil
+}
+
+// fetch reads the database from m.path when set, otherwise downloads the edition from Maxmind.
+// geoip.ErrNotModified is returned when it is the same as the loaded one.
+func (m *maxmind) fetch(ctx context.Context, accountId string, license string) (db *fetchedDatabase, err error) {
+	ctx, span := startSpan(ctx, "database fetch", m.edition)
+	defer func() { endSpan(span, err) }()
+
+	m.mutex.RLock()
+	currentMD5 := m.md5
+	m.mutex.RUnlock()
+
+	if m.path != "" {
+		log.Info().Msg(fmt.Sprintf("Reading database from '%s'", m.path))
+		return fetchFile(ctx, m.edition, m.path, currentMD5)
+	}
+	// Another replica downloads to the shared data directory, only when it has no copy yet this one does
+	if m.dataDir != "" && !election.leader() {
+		if _, statErr := os.Stat(m.cachePath()); statErr == nil {
+			log.Info().Msg(fmt.Sprintf("Reading database downloaded by the downloading replica from '%s'", m.cachePath()))
+			return fetchFile(ctx, m.edition, m.cachePath(), currentMD5)
+		}
+		log.Warn().Msg(fmt.Sprintf("No database downloaded by the downloading replica yet, downloading it (edition: '%s')", m.edition))
+	}
+
+	log.Info().Msg(fmt.Sprintf("Starting database download (edition: '%s')", m.edition))
+	log.Debug().Msg(fmt.Sprintf("Downloading with account '%s' (edition: '%s', current md5: '%s')", accountId, m.edition, currentMD5))
+	db, err = m.download(ctx, accountId, license, currentMD5)
 	if err != nil {
 		return nil, err
 	}
-	defer gzr.Close()
+	log.Info().Msg("Download finished")
+	log.Debug().Msg(fmt.Sprintf("Downloaded to '%s' (edition: '%s', md5: '%s')", db.path, m.edition, db.md5))
+	return db, nil
+}
 
-	tempBytes, err := ioutil.ReadAll(gzr)
-	return tempBytes, nil
+// isCity reports whether the database supports city lookups (City, Country and Enterprise editions)
+func (m *maxmind) isCity() bool {
+	db := m.acquire()
+	defer db.release()
+	_, err := db.City(net.IPv4zero)
+	return !errors.As(err, &geoip2.InvalidMethodError{})
 }
 
-func reload(newDB []byte) error {
-	newReader, err := geoip2.FromBytes(newDB)
-	if err != nil {
-		return err
+// isCountryEdition reports whether the database is a Country edition, without the city data
+func (m *maxmind) isCountryEdition() bool {
+	return strings.HasSuffix(m.edition, "-Country")
+}
+
+// isASN reports whether the database supports ASN lookups (ASN and ISP editions)
+func (m *maxmind) isASN() bool {
+	db := m.acquire()
+	defer db.release()
+	_, err := db.ASN(net.IPv4zero)
+	return !errors.As(err, &geoip2.InvalidMethodError{})
+}
+
+// close releases the database, it is closed once the in-flight lookups are done
+func (m *maxmind) close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// Not loaded yet with --lazy-start
+	if m.db != nil {
+		m.db.release()
+	}
+}
+
+// tracedReload is reload within a span
+func (m *maxmind) tracedReload(ctx context.Context, newDB *fetchedDatabase) error {
+	_, span := startSpan(ctx, "database reload", m.edition)
+	err := m.reload(newDB)
+	endSpan(span, err)
+	return err
+}
+
+// reload swaps in the fetched database, the temporary files are unlinked once mapped
+func (m *maxmind) reload(newDB *fetchedDatabase) error {
+	newReader := newDB.opened
+	if newReader == nil {
+		var err error
+		newReader, err = geoip.OpenFile(newDB.path, m.edition)
+		if newDB.temporary {
+			os.Remove(newDB.path)
+		}
+		if err != nil {
+			return err
+		}
 	}
 	m.mutex.Lock()
-	m.db = newReader
+	oldReader := m.db
+	m.md5 = newDB.md5
+	m.db = newSharedReader(newReader, newRecordCache(m.cacheSize), m.md5)
+	m.loadedBuildEpoch.Store(uint64(newReader.Metadata().BuildEpoch))
 	m.mutex.Unlock()
+
+	// Closed once the in-flight lookups still using it are done
+	if oldReader != nil {
+		oldReader.release()
+	}
 	return nil
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// testCityDatabase loads the GeoIP2 City test database, closed at the end of the test
+func testCityDatabase(t *testing.T, notFound string) *maxmind {
+	m := &maxmind{edition: "GeoIP2-City", notFound: notFound}
+	if err := m.reload(&fetchedDatabase{path: "testdata/GeoIP2-City-Test.mmdb"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.close)
+	return m
+}
+
+// TestLookupCity looks up an IP of the GeoIP2 City test database (see testdata/README.md), with a value expected for
+// every field of geoResponseStruct: a new field must be added here, set by the City lookup unless it is of another
+// edition.
+func TestLookupCity(t *testing.T) {
+	m := testCityDatabase(t, NOT_FOUND_FIELD)
+
+	ipStr := "216.160.83.56"
+	resp, err := m.lookupCity(context.Background(), ipStr, net.ParseIP(ipStr), []string{"en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := true
+	unitedStates := countryStruct{Code: "US", Name: "United States", GeonameID: 6252001}
+	expected := map[string]interface{}{
+		"IP":                ipStr,
+		"CountryCode":       "US",
+		"CountryName":       "United States",
+		"Continent":         "North America",
+		"StateCode":         "WA",
+		"StateName":         "Washington",
+		"CityName":          "Milton",
+		"PostalCode":        "98354",
+		"TimeZone":          "America/Los_Angeles",
+		"Latitude":          47.2513,
+		"Longitude":         -122.3149,
+		"MetroCode":         819,
+		"AccuracyRadius":    uint16(22),
+		"ContinentCode":     "NA",
+		"CountryGeonameID":  uint(6252001),
+		"StateGeonameID":    uint(5815135),
+		"CityGeonameID":     uint(5803556),
+		"Subdivisions":      []subdivisionStruct{{Code: "WA", Name: "Washington", GeonameID: 5815135}},
+		"IsInEuropeanUnion": false,
+		"Network":           "216.160.83.56/29",
+		"Found":             &found,
+		"RegisteredCountry": unitedStates,
+		// Not in the record of the IP
+		"RepresentedCountry": countryStruct{},
+		// Set by the lookups of the other editions
+		"anonymousIPStruct": nil,
+		"ispStruct":         nil,
+		"enterpriseStruct":  nil,
+		"domainStruct":      nil,
+	}
+
+	value := reflect.ValueOf(resp.(geoResponseStruct))
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		want, ok := expected[field.Name]
+		if !ok {
+			t.Errorf("%s (%s): no expected value", field.Name, field.Tag.Get("json"))
+			continue
+		}
+		// The embedded structs are unexported, only their absence is checked
+		if field.Anonymous {
+			if !value.Field(i).IsNil() || want != nil {
+				t.Errorf("%s: expected nil with a City edition alone", field.Name)
+			}
+			continue
+		}
+		if got := value.Field(i).Interface(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s (%s): got %#v, expected %#v", field.Name, field.Tag.Get("json"), got, want)
+		}
+	}
+}
@@ -0,0 +1,1302 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v4.25.0
+// source: geoippb/geoip.proto
+
+package geoippb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LookupRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Ip    string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	// An edition name (ex: "GeoLite2-ASN"), "asn", "country" (only sets the country fields of City) or "full" (every
+	// database merged in City), the default edition when empty
+	Edition string `protobuf:"bytes,2,opt,name=edition,proto3" json:"edition,omitempty"`
+	// Languages to return the names in, by preference (ex: "pt-BR,en"), English when empty
+	Lang          string `protobuf:"bytes,3,opt,name=lang,proto3" json:"lang,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupRequest) Reset() {
+	*x = LookupRequest{}
+	mi := &file_geoippb_geoip_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupRequest) ProtoMessage() {}
+
+func (x *LookupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupRequest.ProtoReflect.Descriptor instead.
+func (*LookupRequest) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupRequest) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *LookupRequest) GetEdition() string {
+	if x != nil {
+		return x.Edition
+	}
+	return ""
+}
+
+func (x *LookupRequest) GetLang() string {
+	if x != nil {
+		return x.Lang
+	}
+	return ""
+}
+
+type LookupResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Result:
+	//
+	//	*LookupResponse_City
+	//	*LookupResponse_Asn
+	//	*LookupResponse_Error
+	//	*LookupResponse_AnonymousIp
+	//	*LookupResponse_Isp
+	//	*LookupResponse_Domain
+	//	*LookupResponse_Bogon
+	Result        isLookupResponse_Result `protobuf_oneof:"result"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupResponse) Reset() {
+	*x = LookupResponse{}
+	mi := &file_geoippb_geoip_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupResponse) ProtoMessage() {}
+
+func (x *LookupResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupResponse.ProtoReflect.Descriptor instead.
+func (*LookupResponse) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LookupResponse) GetResult() isLookupResponse_Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetCity() *City {
+	if x != nil {
+		if x, ok := x.Result.(*LookupResponse_City); ok {
+			return x.City
+		}
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetAsn() *ASN {
+	if x != nil {
+		if x, ok := x.Result.(*LookupResponse_Asn); ok {
+			return x.Asn
+		}
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetError() string {
+	if x != nil {
+		if x, ok := x.Result.(*LookupResponse_Error); ok {
+			return x.Error
+		}
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetAnonymousIp() *AnonymousIP {
+	if x != nil {
+		if x, ok := x.Result.(*LookupResponse_AnonymousIp); ok {
+			return x.AnonymousIp
+		}
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetIsp() *ISP {
+	if x != nil {
+		if x, ok := x.Result.(*LookupResponse_Isp); ok {
+			return x.Isp
+		}
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetDomain() *Domain {
+	if x != nil {
+		if x, ok := x.Result.(*LookupResponse_Domain); ok {
+			return x.Domain
+		}
+	}
+	return nil
+}
+
+func (x *LookupResponse) GetBogon() *Bogon {
+	if x != nil {
+		if x, ok := x.Result.(*LookupResponse_Bogon); ok {
+			return x.Bogon
+		}
+	}
+	return nil
+}
+
+type isLookupResponse_Result interface {
+	isLookupResponse_Result()
+}
+
+type LookupResponse_City struct {
+	City *City `protobuf:"bytes,1,opt,name=city,proto3,oneof"`
+}
+
+type LookupResponse_Asn struct {
+	Asn *ASN `protobuf:"bytes,2,opt,name=asn,proto3,oneof"`
+}
+
+type LookupResponse_Error struct {
+	Error string `protobuf:"bytes,3,opt,name=error,proto3,oneof"`
+}
+
+type LookupResponse_AnonymousIp struct {
+	AnonymousIp *AnonymousIP `protobuf:"bytes,4,opt,name=anonymous_ip,json=anonymousIp,proto3,oneof"`
+}
+
+type LookupResponse_Isp struct {
+	Isp *ISP `protobuf:"bytes,5,opt,name=isp,proto3,oneof"`
+}
+
+type LookupResponse_Domain struct {
+	Domain *Domain `protobuf:"bytes,6,opt,name=domain,proto3,oneof"`
+}
+
+type LookupResponse_Bogon struct {
+	// Private, loopback or reserved IP, with --bogon-status=200
+	Bogon *Bogon `protobuf:"bytes,7,opt,name=bogon,proto3,oneof"`
+}
+
+func (*LookupResponse_City) isLookupResponse_Result() {}
+
+func (*LookupResponse_Asn) isLookupResponse_Result() {}
+
+func (*LookupResponse_Error) isLookupResponse_Result() {}
+
+func (*LookupResponse_AnonymousIp) isLookupResponse_Result() {}
+
+func (*LookupResponse_Isp) isLookupResponse_Result() {}
+
+func (*LookupResponse_Domain) isLookupResponse_Result() {}
+
+func (*LookupResponse_Bogon) isLookupResponse_Result() {}
+
+// LookupResponses are the results of an HTTP batch served as protobuf, in the same order as the IPs
+type LookupResponses struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Responses     []*LookupResponse      `protobuf:"bytes,1,rep,name=responses,proto3" json:"responses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupResponses) Reset() {
+	*x = LookupResponses{}
+	mi := &file_geoippb_geoip_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupResponses) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupResponses) ProtoMessage() {}
+
+func (x *LookupResponses) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupResponses.ProtoReflect.Descriptor instead.
+func (*LookupResponses) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LookupResponses) GetResponses() []*LookupResponse {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+type City struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Ip          string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	CountryCode string                 `protobuf:"bytes,2,opt,name=country_code,json=countryCode,proto3" json:"country_code,omitempty"`
+	CountryName string                 `protobuf:"bytes,3,opt,name=country_name,json=countryName,proto3" json:"country_name,omitempty"`
+	Continent   string                 `protobuf:"bytes,4,opt,name=continent,proto3" json:"continent,omitempty"`
+	RegionCode  string                 `protobuf:"bytes,5,opt,name=region_code,json=regionCode,proto3" json:"region_code,omitempty"`
+	RegionName  string                 `protobuf:"bytes,6,opt,name=region_name,json=regionName,proto3" json:"region_name,omitempty"`
+	City        string                 `protobuf:"bytes,7,opt,name=city,proto3" json:"city,omitempty"`
+	ZipCode     string                 `protobuf:"bytes,8,opt,name=zip_code,json=zipCode,proto3" json:"zip_code,omitempty"`
+	TimeZone    string                 `protobuf:"bytes,9,opt,name=time_zone,json=timeZone,proto3" json:"time_zone,omitempty"`
+	Latitude    float64                `protobuf:"fixed64,10,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude   float64                `protobuf:"fixed64,11,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	MetroCode   int32                  `protobuf:"varint,12,opt,name=metro_code,json=metroCode,proto3" json:"metro_code,omitempty"`
+	// Radius in kilometers around the coordinates where the IP is likely to be
+	AccuracyRadius   uint32 `protobuf:"varint,13,opt,name=accuracy_radius,json=accuracyRadius,proto3" json:"accuracy_radius,omitempty"`
+	ContinentCode    string `protobuf:"bytes,14,opt,name=continent_code,json=continentCode,proto3" json:"continent_code,omitempty"`
+	CountryGeonameId uint32 `protobuf:"varint,15,opt,name=country_geoname_id,json=countryGeonameId,proto3" json:"country_geoname_id,omitempty"`
+	RegionGeonameId  uint32 `protobuf:"varint,16,opt,name=region_geoname_id,json=regionGeonameId,proto3" json:"region_geoname_id,omitempty"`
+	CityGeonameId    uint32 `protobuf:"varint,17,opt,name=city_geoname_id,json=cityGeonameId,proto3" json:"city_geoname_id,omitempty"`
+	// Every subdivision level, from the largest, the region fields are the first one
+	Subdivisions      []*Subdivision `protobuf:"bytes,18,rep,name=subdivisions,proto3" json:"subdivisions,omitempty"`
+	IsInEuropeanUnion bool           `protobuf:"varint,19,opt,name=is_in_european_union,json=isInEuropeanUnion,proto3" json:"is_in_european_union,omitempty"`
+	// The country the IP is registered to (ex: by the ISP), and the one represented by its users (ex: military bases)
+	RegisteredCountry  *Country `protobuf:"bytes,20,opt,name=registered_country,json=registeredCountry,proto3" json:"registered_country,omitempty"`
+	RepresentedCountry *Country `protobuf:"bytes,21,opt,name=represented_country,json=representedCountry,proto3" json:"represented_country,omitempty"`
+	// Set when an Anonymous-IP edition (or --tor-exit-list) is loaded, without the ip
+	AnonymousIp *AnonymousIP `protobuf:"bytes,22,opt,name=anonymous_ip,json=anonymousIp,proto3" json:"anonymous_ip,omitempty"`
+	// Set when an ISP edition is loaded, without the ip
+	Isp *ISP `protobuf:"bytes,23,opt,name=isp,proto3" json:"isp,omitempty"`
+	// Set for Enterprise editions
+	Enterprise *Enterprise `protobuf:"bytes,24,opt,name=enterprise,proto3" json:"enterprise,omitempty"`
+	// Set when a Domain edition is loaded, without the ip
+	Domain *Domain `protobuf:"bytes,25,opt,name=domain,proto3" json:"domain,omitempty"`
+	// Network of the record matching the IP, ex: "81.2.69.0/24"
+	Network string `protobuf:"bytes,26,opt,name=network,proto3" json:"network,omitempty"`
+	// Whether there is a record for the IP, with --not-found=found
+	Found         *bool `protobuf:"varint,27,opt,name=found,proto3,oneof" json:"found,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *City) Reset() {
+	*x = City{}
+	mi := &file_geoippb_geoip_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *City) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*City) ProtoMessage() {}
+
+func (x *City) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use City.ProtoReflect.Descriptor instead.
+func (*City) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *City) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *City) GetCountryCode() string {
+	if x != nil {
+		return x.CountryCode
+	}
+	return ""
+}
+
+func (x *City) GetCountryName() string {
+	if x != nil {
+		return x.CountryName
+	}
+	return ""
+}
+
+func (x *City) GetContinent() string {
+	if x != nil {
+		return x.Continent
+	}
+	return ""
+}
+
+func (x *City) GetRegionCode() string {
+	if x != nil {
+		return x.RegionCode
+	}
+	return ""
+}
+
+func (x *City) GetRegionName() string {
+	if x != nil {
+		return x.RegionName
+	}
+	return ""
+}
+
+func (x *City) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *City) GetZipCode() string {
+	if x != nil {
+		return x.ZipCode
+	}
+	return ""
+}
+
+func (x *City) GetTimeZone() string {
+	if x != nil {
+		return x.TimeZone
+	}
+	return ""
+}
+
+func (x *City) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *City) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *City) GetMetroCode() int32 {
+	if x != nil {
+		return x.MetroCode
+	}
+	return 0
+}
+
+func (x *City) GetAccuracyRadius() uint32 {
+	if x != nil {
+		return x.AccuracyRadius
+	}
+	return 0
+}
+
+func (x *City) GetContinentCode() string {
+	if x != nil {
+		return x.ContinentCode
+	}
+	return ""
+}
+
+func (x *City) GetCountryGeonameId() uint32 {
+	if x != nil {
+		return x.CountryGeonameId
+	}
+	return 0
+}
+
+func (x *City) GetRegionGeonameId() uint32 {
+	if x != nil {
+		return x.RegionGeonameId
+	}
+	return 0
+}
+
+func (x *City) GetCityGeonameId() uint32 {
+	if x != nil {
+		return x.CityGeonameId
+	}
+	return 0
+}
+
+func (x *City) GetSubdivisions() []*Subdivision {
+	if x != nil {
+		return x.Subdivisions
+	}
+	return nil
+}
+
+func (x *City) GetIsInEuropeanUnion() bool {
+	if x != nil {
+		return x.IsInEuropeanUnion
+	}
+	return false
+}
+
+func (x *City) GetRegisteredCountry() *Country {
+	if x != nil {
+		return x.RegisteredCountry
+	}
+	return nil
+}
+
+func (x *City) GetRepresentedCountry() *Country {
+	if x != nil {
+		return x.RepresentedCountry
+	}
+	return nil
+}
+
+func (x *City) GetAnonymousIp() *AnonymousIP {
+	if x != nil {
+		return x.AnonymousIp
+	}
+	return nil
+}
+
+func (x *City) GetIsp() *ISP {
+	if x != nil {
+		return x.Isp
+	}
+	return nil
+}
+
+func (x *City) GetEnterprise() *Enterprise {
+	if x != nil {
+		return x.Enterprise
+	}
+	return nil
+}
+
+func (x *City) GetDomain() *Domain {
+	if x != nil {
+		return x.Domain
+	}
+	return nil
+}
+
+func (x *City) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *City) GetFound() bool {
+	if x != nil && x.Found != nil {
+		return *x.Found
+	}
+	return false
+}
+
+type Country struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Code              string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Name              string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	GeonameId         uint32                 `protobuf:"varint,3,opt,name=geoname_id,json=geonameId,proto3" json:"geoname_id,omitempty"`
+	IsInEuropeanUnion bool                   `protobuf:"varint,4,opt,name=is_in_european_union,json=isInEuropeanUnion,proto3" json:"is_in_european_union,omitempty"`
+	// Type of the represented country, ex: "military"
+	Type          string `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Country) Reset() {
+	*x = Country{}
+	mi := &file_geoippb_geoip_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Country) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Country) ProtoMessage() {}
+
+func (x *Country) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Country.ProtoReflect.Descriptor instead.
+func (*Country) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Country) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Country) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Country) GetGeonameId() uint32 {
+	if x != nil {
+		return x.GeonameId
+	}
+	return 0
+}
+
+func (x *Country) GetIsInEuropeanUnion() bool {
+	if x != nil {
+		return x.IsInEuropeanUnion
+	}
+	return false
+}
+
+func (x *Country) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+type Subdivision struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	GeonameId     uint32                 `protobuf:"varint,3,opt,name=geoname_id,json=geonameId,proto3" json:"geoname_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Subdivision) Reset() {
+	*x = Subdivision{}
+	mi := &file_geoippb_geoip_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Subdivision) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Subdivision) ProtoMessage() {}
+
+func (x *Subdivision) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Subdivision.ProtoReflect.Descriptor instead.
+func (*Subdivision) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Subdivision) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Subdivision) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Subdivision) GetGeonameId() uint32 {
+	if x != nil {
+		return x.GeonameId
+	}
+	return 0
+}
+
+type ASN struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Ip           string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Asn          uint32                 `protobuf:"varint,2,opt,name=asn,proto3" json:"asn,omitempty"`
+	Organization string                 `protobuf:"bytes,3,opt,name=organization,proto3" json:"organization,omitempty"`
+	Network      string                 `protobuf:"bytes,4,opt,name=network,proto3" json:"network,omitempty"`
+	// Whether there is a record for the IP, with --not-found=found
+	Found         *bool `protobuf:"varint,5,opt,name=found,proto3,oneof" json:"found,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ASN) Reset() {
+	*x = ASN{}
+	mi := &file_geoippb_geoip_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ASN) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ASN) ProtoMessage() {}
+
+func (x *ASN) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ASN.ProtoReflect.Descriptor instead.
+func (*ASN) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ASN) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *ASN) GetAsn() uint32 {
+	if x != nil {
+		return x.Asn
+	}
+	return 0
+}
+
+func (x *ASN) GetOrganization() string {
+	if x != nil {
+		return x.Organization
+	}
+	return ""
+}
+
+func (x *ASN) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *ASN) GetFound() bool {
+	if x != nil && x.Found != nil {
+		return *x.Found
+	}
+	return false
+}
+
+type AnonymousIP struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Ip                 string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	IsAnonymous        bool                   `protobuf:"varint,2,opt,name=is_anonymous,json=isAnonymous,proto3" json:"is_anonymous,omitempty"`
+	IsAnonymousVpn     bool                   `protobuf:"varint,3,opt,name=is_anonymous_vpn,json=isAnonymousVpn,proto3" json:"is_anonymous_vpn,omitempty"`
+	IsHostingProvider  bool                   `protobuf:"varint,4,opt,name=is_hosting_provider,json=isHostingProvider,proto3" json:"is_hosting_provider,omitempty"`
+	IsPublicProxy      bool                   `protobuf:"varint,5,opt,name=is_public_proxy,json=isPublicProxy,proto3" json:"is_public_proxy,omitempty"`
+	IsResidentialProxy bool                   `protobuf:"varint,6,opt,name=is_residential_proxy,json=isResidentialProxy,proto3" json:"is_residential_proxy,omitempty"`
+	IsTorExitNode      bool                   `protobuf:"varint,7,opt,name=is_tor_exit_node,json=isTorExitNode,proto3" json:"is_tor_exit_node,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *AnonymousIP) Reset() {
+	*x = AnonymousIP{}
+	mi := &file_geoippb_geoip_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnonymousIP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnonymousIP) ProtoMessage() {}
+
+func (x *AnonymousIP) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnonymousIP.ProtoReflect.Descriptor instead.
+func (*AnonymousIP) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AnonymousIP) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *AnonymousIP) GetIsAnonymous() bool {
+	if x != nil {
+		return x.IsAnonymous
+	}
+	return false
+}
+
+func (x *AnonymousIP) GetIsAnonymousVpn() bool {
+	if x != nil {
+		return x.IsAnonymousVpn
+	}
+	return false
+}
+
+func (x *AnonymousIP) GetIsHostingProvider() bool {
+	if x != nil {
+		return x.IsHostingProvider
+	}
+	return false
+}
+
+func (x *AnonymousIP) GetIsPublicProxy() bool {
+	if x != nil {
+		return x.IsPublicProxy
+	}
+	return false
+}
+
+func (x *AnonymousIP) GetIsResidentialProxy() bool {
+	if x != nil {
+		return x.IsResidentialProxy
+	}
+	return false
+}
+
+func (x *AnonymousIP) GetIsTorExitNode() bool {
+	if x != nil {
+		return x.IsTorExitNode
+	}
+	return false
+}
+
+type ISP struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Isp           string                 `protobuf:"bytes,2,opt,name=isp,proto3" json:"isp,omitempty"`
+	Organization  string                 `protobuf:"bytes,3,opt,name=organization,proto3" json:"organization,omitempty"`
+	Asn           uint32                 `protobuf:"varint,4,opt,name=asn,proto3" json:"asn,omitempty"`
+	AsOrg         string                 `protobuf:"bytes,5,opt,name=as_org,json=asOrg,proto3" json:"as_org,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ISP) Reset() {
+	*x = ISP{}
+	mi := &file_geoippb_geoip_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ISP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ISP) ProtoMessage() {}
+
+func (x *ISP) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ISP.ProtoReflect.Descriptor instead.
+func (*ISP) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ISP) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *ISP) GetIsp() string {
+	if x != nil {
+		return x.Isp
+	}
+	return ""
+}
+
+func (x *ISP) GetOrganization() string {
+	if x != nil {
+		return x.Organization
+	}
+	return ""
+}
+
+func (x *ISP) GetAsn() uint32 {
+	if x != nil {
+		return x.Asn
+	}
+	return 0
+}
+
+func (x *ISP) GetAsOrg() string {
+	if x != nil {
+		return x.AsOrg
+	}
+	return ""
+}
+
+type Enterprise struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionType string                 `protobuf:"bytes,1,opt,name=connection_type,json=connectionType,proto3" json:"connection_type,omitempty"`
+	UserType       string                 `protobuf:"bytes,2,opt,name=user_type,json=userType,proto3" json:"user_type,omitempty"`
+	// Confidences are from 0 to 100
+	CountryConfidence uint32 `protobuf:"varint,3,opt,name=country_confidence,json=countryConfidence,proto3" json:"country_confidence,omitempty"`
+	CityConfidence    uint32 `protobuf:"varint,4,opt,name=city_confidence,json=cityConfidence,proto3" json:"city_confidence,omitempty"`
+	PostalConfidence  uint32 `protobuf:"varint,5,opt,name=postal_confidence,json=postalConfidence,proto3" json:"postal_confidence,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Enterprise) Reset() {
+	*x = Enterprise{}
+	mi := &file_geoippb_geoip_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Enterprise) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Enterprise) ProtoMessage() {}
+
+func (x *Enterprise) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Enterprise.ProtoReflect.Descriptor instead.
+func (*Enterprise) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Enterprise) GetConnectionType() string {
+	if x != nil {
+		return x.ConnectionType
+	}
+	return ""
+}
+
+func (x *Enterprise) GetUserType() string {
+	if x != nil {
+		return x.UserType
+	}
+	return ""
+}
+
+func (x *Enterprise) GetCountryConfidence() uint32 {
+	if x != nil {
+		return x.CountryConfidence
+	}
+	return 0
+}
+
+func (x *Enterprise) GetCityConfidence() uint32 {
+	if x != nil {
+		return x.CityConfidence
+	}
+	return 0
+}
+
+func (x *Enterprise) GetPostalConfidence() uint32 {
+	if x != nil {
+		return x.PostalConfidence
+	}
+	return 0
+}
+
+type Domain struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Ip    string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	// Second level domain of the ISP, ex: "example.com"
+	Domain        string `protobuf:"bytes,2,opt,name=domain,proto3" json:"domain,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Domain) Reset() {
+	*x = Domain{}
+	mi := &file_geoippb_geoip_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Domain) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Domain) ProtoMessage() {}
+
+func (x *Domain) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Domain.ProtoReflect.Descriptor instead.
+func (*Domain) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Domain) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Domain) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+type Bogon struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Bogon) Reset() {
+	*x = Bogon{}
+	mi := &file_geoippb_geoip_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Bogon) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Bogon) ProtoMessage() {}
+
+func (x *Bogon) ProtoReflect() protoreflect.Message {
+	mi := &file_geoippb_geoip_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Bogon.ProtoReflect.Descriptor instead.
+func (*Bogon) Descriptor() ([]byte, []int) {
+	return file_geoippb_geoip_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Bogon) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+var File_geoippb_geoip_proto protoreflect.FileDescriptor
+
+const file_geoippb_geoip_proto_rawDesc = "" +
+	"\n" +
+	"\x13geoippb/geoip.proto\x12\bgeoip.v1\"M\n" +
+	"\rLookupRequest\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x18\n" +
+	"\aedition\x18\x02 \x01(\tR\aedition\x12\x12\n" +
+	"\x04lang\x18\x03 \x01(\tR\x04lang\"\xaf\x02\n" +
+	"\x0eLookupResponse\x12$\n" +
+	"\x04city\x18\x01 \x01(\v2\x0e.geoip.v1.CityH\x00R\x04city\x12!\n" +
+	"\x03asn\x18\x02 \x01(\v2\r.geoip.v1.ASNH\x00R\x03asn\x12\x16\n" +
+	"\x05error\x18\x03 \x01(\tH\x00R\x05error\x12:\n" +
+	"\fanonymous_ip\x18\x04 \x01(\v2\x15.geoip.v1.AnonymousIPH\x00R\vanonymousIp\x12!\n" +
+	"\x03isp\x18\x05 \x01(\v2\r.geoip.v1.ISPH\x00R\x03isp\x12*\n" +
+	"\x06domain\x18\x06 \x01(\v2\x10.geoip.v1.DomainH\x00R\x06domain\x12'\n" +
+	"\x05bogon\x18\a \x01(\v2\x0f.geoip.v1.BogonH\x00R\x05bogonB\b\n" +
+	"\x06result\"I\n" +
+	"\x0fLookupResponses\x126\n" +
+	"\tresponses\x18\x01 \x03(\v2\x18.geoip.v1.LookupResponseR\tresponses\"\x9f\b\n" +
+	"\x04City\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12!\n" +
+	"\fcountry_code\x18\x02 \x01(\tR\vcountryCode\x12!\n" +
+	"\fcountry_name\x18\x03 \x01(\tR\vcountryName\x12\x1c\n" +
+	"\tcontinent\x18\x04 \x01(\tR\tcontinent\x12\x1f\n" +
+	"\vregion_code\x18\x05 \x01(\tR\n" +
+	"regionCode\x12\x1f\n" +
+	"\vregion_name\x18\x06 \x01(\tR\n" +
+	"regionName\x12\x12\n" +
+	"\x04city\x18\a \x01(\tR\x04city\x12\x19\n" +
+	"\bzip_code\x18\b \x01(\tR\azipCode\x12\x1b\n" +
+	"\ttime_zone\x18\t \x01(\tR\btimeZone\x12\x1a\n" +
+	"\blatitude\x18\n" +
+	" \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\v \x01(\x01R\tlongitude\x12\x1d\n" +
+	"\n" +
+	"metro_code\x18\f \x01(\x05R\tmetroCode\x12'\n" +
+	"\x0faccuracy_radius\x18\r \x01(\rR\x0eaccuracyRadius\x12%\n" +
+	"\x0econtinent_code\x18\x0e \x01(\tR\rcontinentCode\x12,\n" +
+	"\x12country_geoname_id\x18\x0f \x01(\rR\x10countryGeonameId\x12*\n" +
+	"\x11region_geoname_id\x18\x10 \x01(\rR\x0fregionGeonameId\x12&\n" +
+	"\x0fcity_geoname_id\x18\x11 \x01(\rR\rcityGeonameId\x129\n" +
+	"\fsubdivisions\x18\x12 \x03(\v2\x15.geoip.v1.SubdivisionR\fsubdivisions\x12/\n" +
+	"\x14is_in_european_union\x18\x13 \x01(\bR\x11isInEuropeanUnion\x12@\n" +
+	"\x12registered_country\x18\x14 \x01(\v2\x11.geoip.v1.CountryR\x11registeredCountry\x12B\n" +
+	"\x13represented_country\x18\x15 \x01(\v2\x11.geoip.v1.CountryR\x12representedCountry\x128\n" +
+	"\fanonymous_ip\x18\x16 \x01(\v2\x15.geoip.v1.AnonymousIPR\vanonymousIp\x12\x1f\n" +
+	"\x03isp\x18\x17 \x01(\v2\r.geoip.v1.ISPR\x03isp\x124\n" +
+	"\n" +
+	"enterprise\x18\x18 \x01(\v2\x14.geoip.v1.EnterpriseR\n" +
+	"enterprise\x12(\n" +
+	"\x06domain\x18\x19 \x01(\v2\x10.geoip.v1.DomainR\x06domain\x12\x18\n" +
+	"\anetwork\x18\x1a \x01(\tR\anetwork\x12\x19\n" +
+	"\x05found\x18\x1b \x01(\bH\x00R\x05found\x88\x01\x01B\b\n" +
+	"\x06_found\"\x95\x01\n" +
+	"\aCountry\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1d\n" +
+	"\n" +
+	"geoname_id\x18\x03 \x01(\rR\tgeonameId\x12/\n" +
+	"\x14is_in_european_union\x18\x04 \x01(\bR\x11isInEuropeanUnion\x12\x12\n" +
+	"\x04type\x18\x05 \x01(\tR\x04type\"T\n" +
+	"\vSubdivision\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1d\n" +
+	"\n" +
+	"geoname_id\x18\x03 \x01(\rR\tgeonameId\"\x8a\x01\n" +
+	"\x03ASN\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x10\n" +
+	"\x03asn\x18\x02 \x01(\rR\x03asn\x12\"\n" +
+	"\forganization\x18\x03 \x01(\tR\forganization\x12\x18\n" +
+	"\anetwork\x18\x04 \x01(\tR\anetwork\x12\x19\n" +
+	"\x05found\x18\x05 \x01(\bH\x00R\x05found\x88\x01\x01B\b\n" +
+	"\x06_found\"\x9d\x02\n" +
+	"\vAnonymousIP\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12!\n" +
+	"\fis_anonymous\x18\x02 \x01(\bR\visAnonymous\x12(\n" +
+	"\x10is_anonymous_vpn\x18\x03 \x01(\bR\x0eisAnonymousVpn\x12.\n" +
+	"\x13is_hosting_provider\x18\x04 \x01(\bR\x11isHostingProvider\x12&\n" +
+	"\x0fis_public_proxy\x18\x05 \x01(\bR\risPublicProxy\x120\n" +
+	"\x14is_residential_proxy\x18\x06 \x01(\bR\x12isResidentialProxy\x12'\n" +
+	"\x10is_tor_exit_node\x18\a \x01(\bR\risTorExitNode\"t\n" +
+	"\x03ISP\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x10\n" +
+	"\x03isp\x18\x02 \x01(\tR\x03isp\x12\"\n" +
+	"\forganization\x18\x03 \x01(\tR\forganization\x12\x10\n" +
+	"\x03asn\x18\x04 \x01(\rR\x03asn\x12\x15\n" +
+	"\x06as_org\x18\x05 \x01(\tR\x05asOrg\"\xd7\x01\n" +
+	"\n" +
+	"Enterprise\x12'\n" +
+	"\x0fconnection_type\x18\x01 \x01(\tR\x0econnectionType\x12\x1b\n" +
+	"\tuser_type\x18\x02 \x01(\tR\buserType\x12-\n" +
+	"\x12country_confidence\x18\x03 \x01(\rR\x11countryConfidence\x12'\n" +
+	"\x0fcity_confidence\x18\x04 \x01(\rR\x0ecityConfidence\x12+\n" +
+	"\x11postal_confidence\x18\x05 \x01(\rR\x10postalConfidence\"0\n" +
+	"\x06Domain\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x16\n" +
+	"\x06domain\x18\x02 \x01(\tR\x06domain\"\x17\n" +
+	"\x05Bogon\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip2\x8b\x01\n" +
+	"\x05GeoIP\x12;\n" +
+	"\x06Lookup\x12\x17.geoip.v1.LookupRequest\x1a\x18.geoip.v1.LookupResponse\x12E\n" +
+	"\fLookupStream\x12\x17.geoip.v1.LookupRequest\x1a\x18.geoip.v1.LookupResponse(\x010\x01B\x16Z\x14geoip-server/geoippbb\x06proto3"
+
+var (
+	file_geoippb_geoip_proto_rawDescOnce sync.Once
+	file_geoippb_geoip_proto_rawDescData []byte
+)
+
+func file_geoippb_geoip_proto_rawDescGZIP() []byte {
+	file_geoippb_geoip_proto_rawDescOnce.Do(func() {
+		file_geoippb_geoip_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_geoippb_geoip_proto_rawDesc), len(file_geoippb_geoip_proto_rawDesc)))
+	})
+	return file_geoippb_geoip_proto_rawDescData
+}
+
+var file_geoippb_geoip_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_geoippb_geoip_proto_goTypes = []any{
+	(*LookupRequest)(nil),   // 0: geoip.v1.LookupRequest
+	(*LookupResponse)(nil),  // 1: geoip.v1.LookupResponse
+	(*LookupResponses)(nil), // 2: geoip.v1.LookupResponses
+	(*City)(nil),            // 3: geoip.v1.City
+	(*Country)(nil),         // 4: geoip.v1.Country
+	(*Subdivision)(nil),     // 5: geoip.v1.Subdivision
+	(*ASN)(nil),             // 6: geoip.v1.ASN
+	(*AnonymousIP)(nil),     // 7: geoip.v1.AnonymousIP
+	(*ISP)(nil),             // 8: geoip.v1.ISP
+	(*Enterprise)(nil),      // 9: geoip.v1.Enterprise
+	(*Domain)(nil),          // 10: geoip.v1.Domain
+	(*Bogon)(nil),           // 11: geoip.v1.Bogon
+}
+var file_geoippb_geoip_proto_depIdxs = []int32{
+	3,  // 0: geoip.v1.LookupResponse.city:type_name -> geoip.v1.City
+	6,  // 1: geoip.v1.LookupResponse.asn:type_name -> geoip.v1.ASN
+	7,  // 2: geoip.v1.LookupResponse.anonymous_ip:type_name -> geoip.v1.AnonymousIP
+	8,  // 3: geoip.v1.LookupResponse.isp:type_name -> geoip.v1.ISP
+	10, // 4: geoip.v1.LookupResponse.domain:type_name -> geoip.v1.Domain
+	11, // 5: geoip.v1.LookupResponse.bogon:type_name -> geoip.v1.Bogon
+	1,  // 6: geoip.v1.LookupResponses.responses:type_name -> geoip.v1.LookupResponse
+	5,  // 7: geoip.v1.City.subdivisions:type_name -> geoip.v1.Subdivision
+	4,  // 8: geoip.v1.City.registered_country:type_name -> geoip.v1.Country
+	4,  // 9: geoip.v1.City.represented_country:type_name -> geoip.v1.Country
+	7,  // 10: geoip.v1.City.anonymous_ip:type_name -> geoip.v1.AnonymousIP
+	8,  // 11: geoip.v1.City.isp:type_name -> geoip.v1.ISP
+	9,  // 12: geoip.v1.City.enterprise:type_name -> geoip.v1.Enterprise
+	10, // 13: geoip.v1.City.domain:type_name -> geoip.v1.Domain
+	0,  // 14: geoip.v1.GeoIP.Lookup:input_type -> geoip.v1.LookupRequest
+	0,  // 15: geoip.v1.GeoIP.LookupStream:input_type -> geoip.v1.LookupRequest
+	1,  // 16: geoip.v1.GeoIP.Lookup:output_type -> geoip.v1.LookupResponse
+	1,  // 17: geoip.v1.GeoIP.LookupStream:output_type -> geoip.v1.LookupResponse
+	16, // [16:18] is the sub-list for method output_type
+	14, // [14:16] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
+}
+
+func init() { file_geoippb_geoip_proto_init() }
+func file_geoippb_geoip_proto_init() {
+	if File_geoippb_geoip_proto != nil {
+		return
+	}
+	file_geoippb_geoip_proto_msgTypes[1].OneofWrappers = []any{
+		(*LookupResponse_City)(nil),
+		(*LookupResponse_Asn)(nil),
+		(*LookupResponse_Error)(nil),
+		(*LookupResponse_AnonymousIp)(nil),
+		(*LookupResponse_Isp)(nil),
+		(*LookupResponse_Domain)(nil),
+		(*LookupResponse_Bogon)(nil),
+	}
+	file_geoippb_geoip_proto_msgTypes[3].OneofWrappers = []any{}
+	file_geoippb_geoip_proto_msgTypes[6].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_geoippb_geoip_proto_rawDesc), len(file_geoippb_geoip_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_geoippb_geoip_proto_goTypes,
+		DependencyIndexes: file_geoippb_geoip_proto_depIdxs,
+		MessageInfos:      file_geoippb_geoip_proto_msgTypes,
+	}.Build()
+	File_geoippb_geoip_proto = out.File
+	file_geoippb_geoip_proto_goTypes = nil
+	file_geoippb_geoip_proto_depIdxs = nil
+}
@@ -0,0 +1,164 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v4.25.0
+// source: geoippb/geoip.proto
+
+package geoippb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GeoIP_Lookup_FullMethodName       = "/geoip.v1.GeoIP/Lookup"
+	GeoIP_LookupStream_FullMethodName = "/geoip.v1.GeoIP/LookupStream"
+)
+
+// GeoIPClient is the client API for GeoIP service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// GeoIP exposes the same lookups as the HTTP API
+type GeoIPClient interface {
+	// Lookup returns the record of an IP
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error)
+	// LookupStream answers every request of the stream, in order. Errors are returned per response
+	// instead of closing the stream.
+	LookupStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[LookupRequest, LookupResponse], error)
+}
+
+type geoIPClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGeoIPClient(cc grpc.ClientConnInterface) GeoIPClient {
+	return &geoIPClient{cc}
+}
+
+func (c *geoIPClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LookupResponse)
+	err := c.cc.Invoke(ctx, GeoIP_Lookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *geoIPClient) LookupStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[LookupRequest, LookupResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GeoIP_ServiceDesc.Streams[0], GeoIP_LookupStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LookupRequest, LookupResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GeoIP_LookupStreamClient = grpc.BidiStreamingClient[LookupRequest, LookupResponse]
+
+// GeoIPServer is the server API for GeoIP service.
+// All implementations must embed UnimplementedGeoIPServer
+// for forward compatibility.
+//
+// GeoIP exposes the same lookups as the HTTP API
+type GeoIPServer interface {
+	// Lookup returns the record of an IP
+	Lookup(context.Context, *LookupRequest) (*LookupResponse, error)
+	// LookupStream answers every request of the stream, in order. Errors are returned per response
+	// instead of closing the stream.
+	LookupStream(grpc.BidiStreamingServer[LookupRequest, LookupResponse]) error
+	mustEmbedUnimplementedGeoIPServer()
+}
+
+// UnimplementedGeoIPServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGeoIPServer struct{}
+
+func (UnimplementedGeoIPServer) Lookup(context.Context, *LookupRequest) (*LookupResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedGeoIPServer) LookupStream(grpc.BidiStreamingServer[LookupRequest, LookupResponse]) error {
+	return status.Error(codes.Unimplemented, "method LookupStream not implemented")
+}
+func (UnimplementedGeoIPServer) mustEmbedUnimplementedGeoIPServer() {}
+func (UnimplementedGeoIPServer) testEmbeddedByValue()               {}
+
+// UnsafeGeoIPServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GeoIPServer will
+// result in compilation errors.
+type UnsafeGeoIPServer interface {
+	mustEmbedUnimplementedGeoIPServer()
+}
+
+func RegisterGeoIPServer(s grpc.ServiceRegistrar, srv GeoIPServer) {
+	// If the following call panics, it indicates UnimplementedGeoIPServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GeoIP_ServiceDesc, srv)
+}
+
+func _GeoIP_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeoIPServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GeoIP_Lookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeoIPServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GeoIP_LookupStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GeoIPServer).LookupStream(&grpc.GenericServerStream[LookupRequest, LookupResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GeoIP_LookupStreamServer = grpc.BidiStreamingServer[LookupRequest, LookupResponse]
+
+// GeoIP_ServiceDesc is the grpc.ServiceDesc for GeoIP service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GeoIP_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "geoip.v1.GeoIP",
+	HandlerType: (*GeoIPServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lookup",
+			Handler:    _GeoIP_Lookup_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "LookupStream",
+			Handler:       _GeoIP_LookupStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "geoippb/geoip.proto",
+}
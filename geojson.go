@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+
+	"github.com/json-iterator/go"
+)
+
+type geoJSONGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string           `json:"type"`
+	Geometry   *geoJSONGeometry `json:"geometry"`
+	Properties selectedFields   `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// encodeGeoJSON writes resp as a Feature (a FeatureCollection for batches) with a Point at its longitude and latitude,
+// the other fields are its properties. The geometry is null without coordinates, ex: ASN lookups or errors.
+func encodeGeoJSON(w io.Writer, resp interface{}) error {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	readFeature := func(iter *jsoniter.Iterator) geoJSONFeature {
+		feature := geoJSONFeature{Type: "Feature", Properties: selectedFields{values: map[string]jsoniter.RawMessage{}}}
+		var latitude, longitude *float64
+		for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+			switch field {
+			case "latitude", "longitude":
+				value := iter.ReadFloat64()
+				if field == "latitude" {
+					latitude = &value
+				} else {
+					longitude = &value
+				}
+			default:
+				feature.Properties.names = append(feature.Properties.names, field)
+				feature.Properties.values[field] = iter.SkipAndReturnBytes()
+			}
+		}
+		if latitude != nil && longitude != nil {
+			feature.Geometry = &geoJSONGeometry{Type: "Point", Coordinates: []float64{*longitude, *latitude}}
+		}
+		return feature
+	}
+
+	var geoJSON interface{}
+	iter := jsoniter.ParseBytes(json, data)
+	if iter.WhatIsNext() == jsoniter.ArrayValue {
+		collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+		for iter.ReadArray() {
+			collection.Features = append(collection.Features, readFeature(iter))
+		}
+		geoJSON = collection
+	} else {
+		geoJSON = readFeature(iter)
+	}
+	if iter.Error != nil {
+		return iter.Error
+	}
+
+	return encodeJSON(w, geoJSON)
+}
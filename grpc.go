@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"geoip-server/geoippb"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer serves the lookups of the HTTP API over gRPC, see geoippb/geoip.proto
+type grpcServer struct {
+	geoippb.UnimplementedGeoIPServer
+	lookups       map[string]lookupFunc
+	defaultLookup lookupFunc
+}
+
+func newGRPCServer(lookups map[string]lookupFunc, defaultLookup lookupFunc, tlsConfig *tls.Config, apiKeys []string) *grpc.Server {
+	options := grpcAPIKeyInterceptors(apiKeys)
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(options...)
+	geoippb.RegisterGeoIPServer(server, &grpcServer{lookups: lookups, defaultLookup: defaultLookup})
+	return server
+}
+
+func serveGRPC(server *grpc.Server, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg(fmt.Sprintf("Serving gRPC on '%s'", address))
+	return server.Serve(listener)
+}
+
+func (s *grpcServer) Lookup(ctx context.Context, req *geoippb.LookupRequest) (*geoippb.LookupResponse, error) {
+	return s.lookup(ctx, req)
+}
+
+func (s *grpcServer) LookupStream(stream grpc.BidiStreamingServer[geoippb.LookupRequest, geoippb.LookupResponse]) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.lookup(stream.Context(), req)
+		if err != nil {
+			resp = &geoippb.LookupResponse{Result: &geoippb.LookupResponse_Error{Error: status.Convert(err).Message()}}
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *grpcServer) lookup(ctx context.Context, req *geoippb.LookupRequest) (*geoippb.LookupResponse, error) {
+	lookup := s.defaultLookup
+	if req.Edition != "" {
+		var ok bool
+		if lookup, ok = s.lookups[req.Edition]; !ok {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("Edition '%s' is not loaded", req.Edition))
+		}
+	}
+
+	ip := net.ParseIP(req.Ip)
+	if ip == nil {
+		log.Info().Msg(fmt.Sprintf("Invalid IP: '%s'", logIP(req.Ip)))
+		return nil, status.Error(codes.InvalidArgument, "Invalid IP address")
+	}
+
+	log.Info().Msg(fmt.Sprintf("Looking up IP '%s' (gRPC)", logIP(req.Ip)))
+
+	resp, err := lookup(ctx, req.Ip, ip, splitLanguages(req.Lang))
+	if err != nil {
+		httpStatus, _, message := lookupError(err)
+		code := codes.Internal
+		if httpStatus == http.StatusNotFound {
+			code = codes.NotFound
+		} else if httpStatus < http.StatusInternalServerError {
+			code = codes.InvalidArgument
+		}
+		return nil, status.Error(code, message)
+	}
+
+	pbResp, err := protoResponse(resp)
+	if err != nil {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	return pbResp, nil
+}
+
+// protoResponse converts the response of a lookup to its protobuf message, shared with the HTTP protobuf format
+func protoResponse(resp interface{}) (*geoippb.LookupResponse, error) {
+	switch resp := resp.(type) {
+	case geoResponseStruct:
+		subdivisions := make([]*geoippb.Subdivision, len(resp.Subdivisions))
+		for i, subdivision := range resp.Subdivisions {
+			subdivisions[i] = &geoippb.Subdivision{
+				Code:      subdivision.Code,
+				Name:      subdivision.Name,
+				GeonameId: uint32(subdivision.GeonameID),
+			}
+		}
+		return &geoippb.LookupResponse{Result: &geoippb.LookupResponse_City{City: &geoippb.City{
+			Ip:          resp.IP,
+			CountryCode: resp.CountryCode,
+			CountryName: resp.CountryName,
+			Continent:   resp.Continent,
+			RegionCode:  resp.StateCode,
+			RegionName:  resp.StateName,
+			City:        resp.CityName,
+			ZipCode:     resp.PostalCode,
+			TimeZone:    resp.TimeZone,
+			Latitude:    resp.Latitude,
+			Longitude:   resp.Longitude,
+			MetroCode:   int32(resp.MetroCode),
+
+			AccuracyRadius:   uint32(resp.AccuracyRadius),
+			ContinentCode:    resp.ContinentCode,
+			CountryGeonameId: uint32(resp.CountryGeonameID),
+			RegionGeonameId:  uint32(resp.StateGeonameID),
+			CityGeonameId:    uint32(resp.CityGeonameID),
+			Subdivisions:     subdivisions,
+
+			IsInEuropeanUnion:  resp.IsInEuropeanUnion,
+			RegisteredCountry:  protoCountry(resp.RegisteredCountry),
+			RepresentedCountry: protoCountry(resp.RepresentedCountry),
+			AnonymousIp:        protoAnonymousIP("", resp.anonymousIPStruct),
+			Isp:                protoISP("", resp.ispStruct),
+			Enterprise:         protoEnterprise(resp.enterpriseStruct),
+			Domain:             protoDomain("", resp.domainStruct),
+			Network:            resp.Network,
+			Found:              resp.Found,
+		}}}, nil
+	case countryResponseStruct:
+		return &geoippb.LookupResponse{Result: &geoippb.LookupResponse_City{City: &geoippb.City{
+			Ip:          resp.IP,
+			CountryCode: resp.CountryCode,
+			CountryName: resp.CountryName,
+
+			IsInEuropeanUnion: resp.IsInEuropeanUnion,
+			Network:           resp.Network,
+			Found:             resp.Found,
+		}}}, nil
+	case asnResponseStruct:
+		return &geoippb.LookupResponse{Result: &geoippb.LookupResponse_Asn{Asn: &geoippb.ASN{
+			Ip:           resp.IP,
+			Asn:          uint32(resp.ASN),
+			Organization: resp.Organization,
+			Network:      resp.Network,
+			Found:        resp.Found,
+		}}}, nil
+	case anonymousIPResponseStruct:
+		return &geoippb.LookupResponse{Result: &geoippb.LookupResponse_AnonymousIp{
+			AnonymousIp: protoAnonymousIP(resp.IP, resp.anonymousIPStruct),
+		}}, nil
+	case ispResponseStruct:
+		return &geoippb.LookupResponse{Result: &geoippb.LookupResponse_Isp{Isp: protoISP(resp.IP, resp.ispStruct)}}, nil
+	case domainResponseStruct:
+		return &geoippb.LookupResponse{Result: &geoippb.LookupResponse_Domain{
+			Domain: protoDomain(resp.IP, resp.domainStruct),
+		}}, nil
+	case bogonResponseStruct:
+		return &geoippb.LookupResponse{Result: &geoippb.LookupResponse_Bogon{Bogon: &geoippb.Bogon{Ip: resp.IP}}}, nil
+	case hostnameResponse:
+		return protoResponse(resp.resp)
+	case batchErrorStruct:
+		return &geoippb.LookupResponse{Result: &geoippb.LookupResponse_Error{Error: resp.Error}}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported response type %T", resp)
+	}
+}
+
+func protoCountry(country countryStruct) *geoippb.Country {
+	return &geoippb.Country{
+		Code:              country.Code,
+		Name:              country.Name,
+		GeonameId:         uint32(country.GeonameID),
+		IsInEuropeanUnion: country.IsInEuropeanUnion,
+		Type:              country.Type,
+	}
+}
+
+func protoAnonymousIP(ip string, anonymous *anonymousIPStruct) *geoippb.AnonymousIP {
+	if anonymous == nil {
+		return nil
+	}
+	return &geoippb.AnonymousIP{
+		Ip:                 ip,
+		IsAnonymous:        anonymous.IsAnonymous,
+		IsAnonymousVpn:     anonymous.IsAnonymousVPN,
+		IsHostingProvider:  anonymous.IsHostingProvider,
+		IsPublicProxy:      anonymous.IsPublicProxy,
+		IsResidentialProxy: anonymous.IsResidentialProxy,
+		IsTorExitNode:      anonymous.IsTorExitNode,
+	}
+}
+
+func protoISP(ip string, isp *ispStruct) *geoippb.ISP {
+	if isp == nil {
+		return nil
+	}
+	return &geoippb.ISP{
+		Ip:           ip,
+		Isp:          isp.ISP,
+		Organization: isp.Organization,
+		Asn:          uint32(isp.ASN),
+		AsOrg:        isp.ASOrg,
+	}
+}
+
+func protoEnterprise(enterprise *enterpriseStruct) *geoippb.Enterprise {
+	if enterprise == nil {
+		return nil
+	}
+	return &geoippb.Enterprise{
+		ConnectionType:    enterprise.ConnectionType,
+		UserType:          enterprise.UserType,
+		CountryConfidence: uint32(enterprise.CountryConfidence),
+		CityConfidence:    uint32(enterprise.CityConfidence),
+		PostalConfidence:  uint32(enterprise.PostalConfidence),
+	}
+}
+
+func protoDomain(ip string, domain *domainStruct) *geoippb.Domain {
+	if domain == nil {
+		return nil
+	}
+	return &geoippb.Domain{Ip: ip, Domain: domain.Domain}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type readinessStruct struct {
+	Ready     bool                      `json:"ready"`
+	Databases []databaseReadinessStruct `json:"databases"`
+}
+
+type databaseReadinessStruct struct {
+	Edition           string    `json:"edition"`
+	Loaded            bool      `json:"loaded"`
+	BuildTime         time.Time `json:"build_time"`
+	LastUpdateAttempt time.Time `json:"last_update_attempt"`
+	LastUpdateError   string    `json:"last_update_error,omitempty"`
+	// Time of the last successful update, or check finding it up to date
+	LastUpdate time.Time `json:"last_update"`
+}
+
+func (m *maxmind) readiness() databaseReadinessStruct {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	readiness := databaseReadinessStruct{
+		Edition:           m.edition,
+		Loaded:            m.db != nil,
+		LastUpdateAttempt: m.lastAttempt,
+		LastUpdate:        m.lastSuccess,
+	}
+	if m.db != nil {
+		readiness.BuildTime = time.Unix(int64(m.db.Metadata().BuildEpoch), 0).UTC()
+	}
+	if m.lastAttemptErr != nil {
+		readiness.LastUpdateError = m.lastAttemptErr.Error()
+	}
+	return readiness
+}
+
+// readinessHandler responds 200 when every database is loaded and, if maxAge is set, built less than maxAge ago.
+// Failed update attempts are reported but don't fail the check while the loaded database is recent enough, and, if
+// maxUpdateAge is set, the last successful update was less than maxUpdateAge ago (ex: to notice an expired license).
+func readinessHandler(databases []*maxmind, maxAge time.Duration, maxUpdateAge time.Duration) httprouter.Handle {
+	return func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		resp := readinessStruct{Ready: true}
+		for _, m := range databases {
+			readiness := m.readiness()
+			if !readiness.Loaded || (maxAge > 0 && time.Since(readiness.BuildTime) > maxAge) {
+				resp.Ready = false
+			}
+			if maxUpdateAge > 0 && time.Since(readiness.LastUpdate) > maxUpdateAge {
+				resp.Ready = false
+			}
+			resp.Databases = append(resp.Databases, readiness)
+		}
+
+		if !resp.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		geoResponse(w, resp)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// hostnameResolver resolves the hostnames looked up in place of IPs (ex: "/geoip/example.com"), with --resolve-hostnames
+type hostnameResolver struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+// newHostnameResolver returns a resolver using the system one, or the DNS server at address (ex: "1.1.1.1:53")
+func newHostnameResolver(address string, timeout time.Duration) *hostnameResolver {
+	resolver := net.DefaultResolver
+	if address != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, address)
+			},
+		}
+	}
+	return &hostnameResolver{resolver: resolver, timeout: timeout}
+}
+
+// resolve returns the first address of hostname, of the given family when not empty ("ipv4" or "ipv6")
+func (r *hostnameResolver) resolve(ctx context.Context, hostname string, family string) (net.IP, error) {
+	network := "ip"
+	switch family {
+	case "":
+	case "ipv4":
+		network = "ip4"
+	case "ipv6":
+		network = "ip6"
+	default:
+		return nil, fmt.Errorf("invalid family '%s', expected 'ipv4' or 'ipv6'", family)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ips, err := r.resolver.LookupIP(ctx, network, hostname)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no address")
+	}
+	return ips[0], nil
+}
+
+// reverse returns the first name the IP resolves back to (PTR record), without the trailing dot, empty when none
+func (r *hostnameResolver) reverse(ctx context.Context, ip net.IP) string {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	names, err := r.resolver.LookupAddr(ctx, ip.String())
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// hostnamePattern matches the hostnames, the top level domain starts with a letter so that malformed IPv4 do not
+var hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z][a-zA-Z0-9-]{0,62}\.?$`)
+
+// hostnameResponse is the response of a hostname lookup, with the hostname field first
+type hostnameResponse struct {
+	hostname string
+	resp     interface{}
+}
+
+func (h hostnameResponse) fields() (selectedFields, error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	data, err := json.Marshal(h.resp)
+	if err != nil {
+		return selectedFields{}, err
+	}
+
+	hostname, _ := json.Marshal(h.hostname)
+	fields := selectedFields{names: []string{"hostname"}, values: map[string]jsoniter.RawMessage{"hostname": hostname}}
+	iter := jsoniter.ParseBytes(json, data)
+	for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+		fields.names = append(fields.names, field)
+		fields.values[field] = iter.SkipAndReturnBytes()
+	}
+	return fields, iter.Error
+}
+
+func (h hostnameResponse) MarshalJSON() ([]byte, error) {
+	fields, err := h.fields()
+	if err != nil {
+		return nil, err
+	}
+	return fields.MarshalJSON()
+}
+
+func (h hostnameResponse) EncodeMsgpack(encoder *msgpack.Encoder) error {
+	fields, err := h.fields()
+	if err != nil {
+		return err
+	}
+	return fields.EncodeMsgpack(encoder)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// cacheWriter adds the caching headers to the successful responses only, errors are not cached
+type cacheWriter struct {
+	http.ResponseWriter
+	cacheControl string
+	etag         string
+	wroteHeader  bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK {
+		w.Header().Set("Cache-Control", w.cacheControl)
+		w.Header().Set("ETag", w.etag)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// lookupETag identifies a lookup response: the IP (part of the path, or the client one), the query and negotiated
+// headers selecting its representation, and the build of every database, as any of them may enrich it
+func lookupETag(r *http.Request, clientIP string, databases []*maxmind) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n%s\n", r.URL.Path, r.URL.RawQuery, clientIP, r.Header.Get("Accept"), r.Header.Get("Accept-Language"))
+	for _, m := range databases {
+		fmt.Fprintf(hash, "%s:%d\n", m.edition, m.buildEpoch())
+	}
+	return fmt.Sprintf(`W/"%x"`, hash.Sum(nil)[:12])
+}
+
+// etagMatches reports whether the If-None-Match header of the request has etag
+func etagMatches(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// httpCacheMiddleware lets browsers and CDNs cache the lookups for maxAge (until the next database update check):
+// successful responses get Cache-Control and an ETag, and a request with If-None-Match of the current one is answered
+// 304. The responses for the client IP vary per client, and with API keys the shared caches would serve them to the
+// clients without one, so only the client's own cache may store those.
+func httpCacheMiddleware(next httprouter.Handle, databases []*maxmind, maxAge time.Duration, resolver *clientIPResolver, authenticated bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		cacheControl := fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+		clientIP := ""
+		if ps.ByName("ip") == "" {
+			clientIP = resolver.clientIP(r)
+		}
+		if ps.ByName("ip") == "" || authenticated {
+			cacheControl = fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds()))
+		}
+		if authenticated {
+			w.Header().Add("Vary", "X-API-Key")
+			w.Header().Add("Vary", "Authorization")
+		}
+		etag := lookupETag(r, clientIP, databases)
+
+		if etagMatches(r, etag) {
+			w.Header().Set("Cache-Control", cacheControl)
+			w.Header().Set("ETag", etag)
+			// Like the lookup responses
+			w.Header().Add("Vary", "Accept")
+			w.Header().Add("Vary", "Accept-Language")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next(&cacheWriter{ResponseWriter: w, cacheControl: cacheControl, etag: etag}, r, ps)
+	}
+}
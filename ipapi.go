@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// ipapiResponseStruct is the response of ip-api.com, with its field names and order
+type ipapiResponseStruct struct {
+	// success or fail
+	Status string `json:"status"`
+	// Why the lookup failed: private range, reserved range or invalid query
+	Message       string  `json:"message,omitempty"`
+	Continent     string  `json:"continent"`
+	ContinentCode string  `json:"continentCode"`
+	Country       string  `json:"country"`
+	CountryCode   string  `json:"countryCode"`
+	Region        string  `json:"region"`
+	RegionName    string  `json:"regionName"`
+	City          string  `json:"city"`
+	District      string  `json:"district"`
+	Zip           string  `json:"zip"`
+	Lat           float64 `json:"lat"`
+	Lon           float64 `json:"lon"`
+	Timezone      string  `json:"timezone"`
+	// Current UTC offset of the time zone in seconds
+	Offset   int    `json:"offset"`
+	Currency string `json:"currency"`
+	ISP      string `json:"isp"`
+	Org      string `json:"org"`
+	// Number and organization, ex: "AS15169 Google LLC"
+	AS     string `json:"as"`
+	ASName string `json:"asname"`
+	// Reverse DNS of the IP, only resolved with --resolve-hostnames
+	Reverse string `json:"reverse"`
+	Mobile  bool   `json:"mobile"`
+	Proxy   bool   `json:"proxy"`
+	Hosting bool   `json:"hosting"`
+	// The IP looked up
+	Query string `json:"query"`
+}
+
+// ipapiFields are the fields of the ip-api.com response in order, with their bit in the numeric fields parameter
+var ipapiFields = []struct {
+	name string
+	bit  int
+}{
+	{"status", 1 << 14}, {"message", 1 << 15}, {"continent", 1 << 20}, {"continentCode", 1 << 21}, {"country", 1 << 0},
+	{"countryCode", 1 << 1}, {"region", 1 << 2}, {"regionName", 1 << 3}, {"city", 1 << 4}, {"district", 1 << 19},
+	{"zip", 1 << 5}, {"lat", 1 << 6}, {"lon", 1 << 7}, {"timezone", 1 << 8}, {"offset", 1 << 25}, {"currency", 1 << 23},
+	{"isp", 1 << 9}, {"org", 1 << 10}, {"as", 1 << 11}, {"asname", 1 << 22}, {"reverse", 1 << 12}, {"mobile", 1 << 16},
+	{"proxy", 1 << 17}, {"hosting", 1 << 24}, {"query", 1 << 13},
+}
+
+// IPAPI_DEFAULT_FIELDS are the fields of the responses without fields parameter, as the numeric parameter
+const IPAPI_DEFAULT_FIELDS int = 1<<14 | 1<<15 | 1<<0 | 1<<1 | 1<<2 | 1<<3 | 1<<4 | 1<<5 | 1<<6 | 1<<7 | 1<<8 | 1<<9 |
+	1<<10 | 1<<11 | 1<<13
+
+// ipapiRoutes serves the ip-api.com API: /json/<ip>, the client IP without one. The failed lookups are a 200 with
+// the fail status, as ip-api does.
+func ipapiRoutes(router *httprouter.Router, prefix string, c *compatContext) {
+	route := prefix + "/json/*ip"
+	router.GET(route, c.apiRoute(route, ipapiHandler(c)))
+}
+
+func ipapiHandler(c *compatContext) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		fields := ipapiRequestFields(r.URL.Query().Get("fields"))
+		// The failed lookups only have these fields
+		fail := func(message, query string) {
+			failFields := slices.DeleteFunc(slices.Clone(fields), func(field string) bool {
+				return field != "status" && field != "message" && field != "query"
+			})
+			resp, _, err := selectFields(ipapiResponseStruct{Status: "fail", Message: message, Query: query}, failFields)
+			if err != nil {
+				errResponse(w, http.StatusInternalServerError, ERR_INTERNAL, "")
+				return
+			}
+			geoResponse(w, resp)
+		}
+
+		query := strings.TrimPrefix(ps.ByName("ip"), "/")
+		if query == "" {
+			query = c.resolver.clientIP(r)
+		}
+		ip := net.ParseIP(query)
+		if ip == nil && c.hostnames != nil && hostnamePattern.MatchString(query) {
+			resolved, err := c.hostnames.resolve(r.Context(), query, "")
+			if err != nil {
+				log.Info().Err(err).Msg(fmt.Sprintf("Resolving '%s' failed", query))
+			}
+			ip = resolved
+		}
+		if ip == nil {
+			log.Info().Msg(fmt.Sprintf("Invalid IP: '%s'", logIP(query)))
+			fail("invalid query", query)
+			return
+		}
+		ipStr := ip.String()
+		if isBogon(ip) {
+			if ip.IsPrivate() {
+				fail("private range", ipStr)
+			} else {
+				fail("reserved range", ipStr)
+			}
+			return
+		}
+		log.Info().Msg(fmt.Sprintf("Looking up IP '%s'", logIP(ipStr)))
+
+		geo := geoResponseStruct{IP: ipStr}
+		record, err := c.lookup(r.Context(), ipStr, ip, requestLanguages(r))
+		if err != nil {
+			status, code, message := lookupError(err)
+			errResponse(w, status, code, message)
+			return
+		}
+		if found, ok := record.(geoResponseStruct); ok {
+			geo = found
+		}
+
+		resp := ipapiResponseStruct{
+			Status:        "success",
+			Continent:     geo.Continent,
+			ContinentCode: geo.ContinentCode,
+			Country:       geo.CountryName,
+			CountryCode:   geo.CountryCode,
+			Region:        geo.StateCode,
+			RegionName:    geo.StateName,
+			City:          geo.CityName,
+			Zip:           geo.PostalCode,
+			Lat:           geo.Latitude,
+			Lon:           geo.Longitude,
+			Timezone:      geo.TimeZone,
+			Offset:        timeZoneOffset(geo.TimeZone),
+			Query:         ipStr,
+		}
+		if geo.ispStruct != nil {
+			resp.ISP, resp.Org, resp.ASName = geo.ISP, geo.Organization, geo.ASOrg
+			if resp.ISP == "" {
+				resp.ISP = geo.ASOrg
+			}
+			if resp.Org == "" {
+				resp.Org = geo.ASOrg
+			}
+			if geo.ASN != 0 {
+				resp.AS = strings.TrimSpace(fmt.Sprintf("AS%d %s", geo.ASN, geo.ASOrg))
+			}
+		}
+		if geo.anonymousIPStruct != nil {
+			resp.Proxy = geo.IsPublicProxy || geo.IsAnonymousVPN || geo.IsTorExitNode || geo.IsResidentialProxy
+			resp.Hosting = geo.IsHostingProvider
+		}
+		// A DNS query, only when asked for
+		if c.hostnames != nil && slices.Contains(fields, "reverse") {
+			resp.Reverse = c.hostnames.reverse(r.Context(), ip)
+		}
+
+		// Like ip-api, the unknown fields are left out
+		selected, _, err := selectFields(resp, fields)
+		if err != nil {
+			errResponse(w, http.StatusInternalServerError, ERR_INTERNAL, "")
+			return
+		}
+		geoResponse(w, selected)
+	}
+}
+
+// ipapiRequestFields returns the names of the fields parameter in the order of the response, a bitmask (ex: 66846719)
+// or a list (ex: status,country,query), the default fields when empty
+func ipapiRequestFields(param string) []string {
+	mask, err := strconv.Atoi(param)
+	if param == "" {
+		mask, err = IPAPI_DEFAULT_FIELDS, nil
+	}
+	var names map[string]bool
+	if err != nil {
+		names = map[string]bool{}
+		for _, name := range strings.Split(param, ",") {
+			names[strings.TrimSpace(name)] = true
+		}
+	}
+
+	fields := []string{}
+	for _, field := range ipapiFields {
+		if names != nil && names[field.name] || names == nil && mask&field.bit != 0 {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
+
+// timeZoneOffset is the current UTC offset in seconds of an IANA time zone, 0 when unknown
+func timeZoneOffset(name string) int {
+	if name == "" {
+		return 0
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return 0
+	}
+	_, offset := time.Now().In(location).Zone()
+	return offset
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// ipinfoResponseStruct is the response of ipinfo.io, with its field names and order
+type ipinfoResponseStruct struct {
+	IP string `json:"ip"`
+	// Reverse DNS of the IP, only resolved with --resolve-hostnames
+	Hostname string `json:"hostname,omitempty"`
+	City     string `json:"city"`
+	// Name of the region, ex: "California"
+	Region  string `json:"region"`
+	Country string `json:"country"`
+	// "<latitude>,<longitude>", ex: "37.4056,-122.0775"
+	Loc string `json:"loc"`
+	// Number and organization of the AS, ex: "AS15169 Google LLC"
+	Org      string `json:"org,omitempty"`
+	Postal   string `json:"postal"`
+	Timezone string `json:"timezone"`
+}
+
+// ipinfoFields are the fields served as text, ex: /8.8.8.8/country
+var ipinfoFields = map[string]bool{
+	"ip": true, "hostname": true, "city": true, "region": true, "country": true, "loc": true, "org": true,
+	"postal": true, "timezone": true,
+}
+
+// ipinfoRoot serves the ipinfo.io API: /<ip> (or /<ip>/json) and /<ip>/<field> as text (ex: /8.8.8.8/country), the
+// client IP without one (ex: /json or /country). Its token parameter is taken as the API key, and the bogons are
+// answered with {"ip", "bogon": true} as ipinfo does (with --bogon-status 200).
+func ipinfoRoot(prefix string, c *compatContext) httprouter.Handle {
+	route := prefix + "/:ip"
+	return queryAPIKey("token", c.apiRoute(route, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var ip, field string
+		switch parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix+"/"), "/"); {
+		case len(parts) == 1 && (parts[0] == "" || parts[0] == "json"):
+		case len(parts) == 1 && ipinfoFields[parts[0]]:
+			field = parts[0]
+		case len(parts) == 1:
+			ip = parts[0]
+		case len(parts) == 2 && parts[1] == "json":
+			ip = parts[0]
+		case len(parts) == 2 && ipinfoFields[parts[1]]:
+			ip, field = parts[0], parts[1]
+		case len(parts) == 2:
+			errResponse(w, http.StatusNotFound, ERR_UNKNOWN_FIELD, fmt.Sprintf("Unknown field '%s'", parts[1]))
+			return
+		default:
+			errResponse(w, http.StatusNotFound, ERR_NOT_FOUND, "Unknown route")
+			return
+		}
+
+		ipStr, record, ok := c.lookupRecord(w, r, httprouter.Params{{Key: "ip", Value: ip}})
+		if !ok {
+			return
+		}
+		resp := ipinfoResponseStruct{IP: ipStr}
+		switch record := record.(type) {
+		case bogonResponseStruct:
+			if field == "" {
+				geoResponse(w, record)
+				return
+			}
+		case geoResponseStruct:
+			resp.City, resp.Region, resp.Country = record.CityName, record.StateName, record.CountryCode
+			resp.Postal, resp.Timezone = record.PostalCode, record.TimeZone
+			resp.Loc = strconv.FormatFloat(record.Latitude, 'f', 4, 64) + "," +
+				strconv.FormatFloat(record.Longitude, 'f', 4, 64)
+			if record.ispStruct != nil && record.ASN != 0 {
+				resp.Org = strings.TrimSpace(fmt.Sprintf("AS%d %s", record.ASN, record.ASOrg))
+			}
+			// A DNS query, only when served
+			if c.hostnames != nil && (field == "" || field == "hostname") {
+				resp.Hostname = c.hostnames.reverse(r.Context(), net.ParseIP(ipStr))
+			}
+		}
+
+		if field == "" {
+			geoResponse(w, resp)
+			return
+		}
+		selected, _, err := selectFields(resp, []string{field})
+		if err != nil {
+			errResponse(w, http.StatusInternalServerError, ERR_INTERNAL, "")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := io.WriteString(w, plainValue(selected.(selectedFields).values[field])+"\n"); err != nil {
+			log.Error().Err(err).Msg("")
+		}
+	}))
+}
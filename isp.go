@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// ispStruct are the fields of the GeoIP2-ISP edition, added to the city responses when it is loaded
+type ispStruct struct {
+	ISP          string `json:"isp"`
+	Organization string `json:"organization"`
+	ASN          uint   `json:"asn"`
+	ASOrg        string `json:"as_org"`
+}
+
+type ispResponseStruct struct {
+	IP string `json:"ip"`
+	*ispStruct
+}
+
+// isISP reports whether the database supports ISP lookups (ISP edition)
+func (m *maxmind) isISP() bool {
+	db := m.acquire()
+	defer db.release()
+	_, err := db.ISP(net.IPv4zero)
+	return !errors.As(err, &geoip2.InvalidMethodError{})
+}
+
+func (m *maxmind) isp(ctx context.Context, ip net.IP) (*ispStruct, error) {
+	record, err := m.record(ctx, "isp", ip, func(db *sharedReader) (interface{}, error) {
+		return db.ISP(ip)
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return nil, err
+	}
+	isp := record.(*geoip2.ISP)
+
+	return &ispStruct{
+		ISP:          isp.ISP,
+		Organization: isp.Organization,
+		ASN:          isp.AutonomousSystemNumber,
+		ASOrg:        isp.AutonomousSystemOrganization,
+	}, nil
+}
+
+func (m *maxmind) lookupISP(ctx context.Context, ipStr string, ip net.IP, _ []string) (interface{}, error) {
+	isp, err := m.isp(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	return ispResponseStruct{IP: ipStr, ispStruct: isp}, nil
+}
+
+// enrichISP adds the ISP fields to the city responses
+func (m *maxmind) enrichISP(ctx context.Context, ip net.IP, resp *geoResponseStruct) error {
+	isp, err := m.isp(ctx, ip)
+	if err != nil {
+		return err
+	}
+	resp.ispStruct = isp
+	return nil
+}
+
+// enrichASN adds the asn and as_org fields of an ASN edition to the city responses, unless an ISP edition already did
+func (m *maxmind) enrichASN(ctx context.Context, ip net.IP, resp *geoResponseStruct) error {
+	if resp.ispStruct != nil {
+		return nil
+	}
+
+	record, err := m.record(ctx, "asn", ip, func(db *sharedReader) (interface{}, error) {
+		return db.ASN(ip)
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return err
+	}
+	asn := record.(*geoip2.ASN)
+
+	resp.ispStruct = &ispStruct{ASN: asn.AutonomousSystemNumber, ASOrg: asn.AutonomousSystemOrganization}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// jsonpCallback restricts the callback names to JavaScript identifiers (ex: "jQuery123_456" or "app.onGeo")
+var jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$.]{0,127}$`)
+
+// jsonpWriter wraps JSON responses in a call to the callback, other formats are written untouched
+type jsonpWriter struct {
+	http.ResponseWriter
+	callback    string
+	wroteHeader bool
+	wrapped     bool
+}
+
+func (w *jsonpWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if contentType := w.Header().Get("Content-Type"); contentType == "application/json" || contentType == PROBLEM_CONTENT_TYPE {
+		w.wrapped = true
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(code)
+	if w.wrapped {
+		// The comment prevents the response from being interpreted as something else than JavaScript
+		_, _ = w.ResponseWriter.Write([]byte("/**/" + w.callback + "("))
+	}
+}
+
+func (w *jsonpWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// jsonpMiddleware serves the JSON responses as JSONP when the request has ?callback=
+func jsonpMiddleware(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		callback := r.URL.Query().Get("callback")
+		if callback == "" {
+			next(w, r, ps)
+			return
+		}
+		if !jsonpCallback.MatchString(callback) {
+			errResponse(w, http.StatusBadRequest, ERR_INVALID_CALLBACK, "Invalid callback")
+			return
+		}
+
+		jw := &jsonpWriter{ResponseWriter: w, callback: callback}
+		next(jw, r, ps)
+		if jw.wrapped {
+			_, _ = w.Write([]byte(");"))
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/pflag"
+)
+
+// KAFKA_BATCH_SIZE is the maximum number of messages enriched at once, produced then committed together
+const KAFKA_BATCH_SIZE int = 100
+
+// KAFKA_BATCH_TIMEOUT is how long a batch waits for more messages once it has one
+const KAFKA_BATCH_TIMEOUT time.Duration = 100 * time.Millisecond
+
+// kafkaRetry is how the failed produces and commits of a batch are retried, until the shutdown
+var kafkaRetry = retryPolicy{delay: time.Second, maxDelay: time.Minute}
+
+// kafkaOptions are the Kafka topics of the stream enrichment
+type kafkaOptions struct {
+	brokers     []string
+	inputTopic  string
+	outputTopic string
+	group       string
+	ipField     string
+	outputField string
+}
+
+func addKafkaFlags(flags *pflag.FlagSet) *kafkaOptions {
+	options := &kafkaOptions{}
+	flags.StringSliceVar(&options.brokers, "kafka-brokers", []string{}, "Kafka brokers (host:port) to consume the JSON messages to enrich from, disabled when none is set")
+	flags.StringVar(&options.inputTopic, "kafka-input-topic", "", "Topic of the messages to enrich")
+	flags.StringVar(&options.outputTopic, "kafka-output-topic", "", "Topic to produce the enriched messages to")
+	flags.StringVar(&options.group, "kafka-group", "geoip-server", "Consumer group of the enrichment, sharing the partitions of the input topic between the replicas")
+	flags.StringVar(&options.ipField, "kafka-ip-field", "ip", "Dot separated path of the IP in the messages, ex: client.ip")
+	flags.StringVar(&options.outputField, "kafka-output-field", "geoip", "Dot separated path to add the lookup response at, ex: client.geo")
+	return options
+}
+
+func (o *kafkaOptions) enabled() bool {
+	return len(o.brokers) > 0
+}
+
+func (o *kafkaOptions) validate() error {
+	if !o.enabled() {
+		return nil
+	}
+	if o.inputTopic == "" || o.outputTopic == "" {
+		return errors.New("--kafka-brokers requires --kafka-input-topic and --kafka-output-topic")
+	}
+	if o.inputTopic == o.outputTopic {
+		return errors.New("--kafka-output-topic must not be the input topic, the enriched messages would be enriched again")
+	}
+	return nil
+}
+
+// kafkaEnricher consumes the JSON messages of the input topic and produces them to the output topic with the lookup
+// response of their IP, committing them once produced: a message is enriched at least once. The messages without IP
+// or which are not JSON objects are produced unchanged, and their key and headers kept.
+type kafkaEnricher struct {
+	options *kafkaOptions
+	lookup  lookupFunc
+	reader  *kafka.Reader
+	writer  *kafka.Writer
+}
+
+func newKafkaEnricher(options *kafkaOptions, lookup lookupFunc) *kafkaEnricher {
+	// The connection errors, retried by kafka-go
+	errorLogger := kafka.LoggerFunc(func(message string, args ...interface{}) {
+		log.Error().Msg(fmt.Sprintf("Kafka: "+message, args...))
+	})
+	return &kafkaEnricher{
+		options: options,
+		lookup:  lookup,
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     options.brokers,
+			GroupID:     options.group,
+			Topic:       options.inputTopic,
+			ErrorLogger: errorLogger,
+		}),
+		writer: &kafka.Writer{
+			Addr:  kafka.TCP(options.brokers...),
+			Topic: options.outputTopic,
+			// The messages of a key stay in order, in the same partition
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchSize:    KAFKA_BATCH_SIZE,
+			BatchTimeout: 10 * time.Millisecond,
+			ErrorLogger:  errorLogger,
+		},
+	}
+}
+
+// run enriches the messages until ctx is done, finishing the batch in progress
+func (e *kafkaEnricher) run(ctx context.Context) error {
+	defer func() {
+		if err := e.reader.Close(); err != nil {
+			log.Error().Err(err).Msg("Closing the Kafka consumer failed")
+		}
+		if err := e.writer.Close(); err != nil {
+			log.Error().Err(err).Msg("Closing the Kafka producer failed")
+		}
+	}()
+	log.Info().Msg(fmt.Sprintf(
+		"Enriching the Kafka messages of '%s' to '%s' (group '%s')",
+		e.options.inputTopic, e.options.outputTopic, e.options.group,
+	))
+
+	for {
+		batch, err := e.fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		enriched := make([]kafka.Message, len(batch))
+		for i, message := range batch {
+			value, result := e.enrich(ctx, message.Value)
+			kafkaMessagesTotal.WithLabelValues(result).Inc()
+			enriched[i] = kafka.Message{Key: message.Key, Headers: message.Headers, Value: value}
+		}
+
+		// Not canceled by the shutdown, a batch produced but not committed would be enriched twice
+		batchCtx := context.WithoutCancel(ctx)
+		if !e.retry(ctx, "Producing the enriched Kafka messages", func() error {
+			return e.writer.WriteMessages(batchCtx, enriched...)
+		}) {
+			return nil
+		}
+		if !e.retry(ctx, "Committing the Kafka messages", func() error {
+			return e.reader.CommitMessages(batchCtx, batch...)
+		}) {
+			return nil
+		}
+	}
+}
+
+// fetch returns the next messages, waiting for the first one then at most KAFKA_BATCH_TIMEOUT for the others
+func (e *kafkaEnricher) fetch(ctx context.Context) ([]kafka.Message, error) {
+	message, err := e.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := []kafka.Message{message}
+	ctx, cancel := context.WithTimeout(ctx, KAFKA_BATCH_TIMEOUT)
+	defer cancel()
+	for len(batch) < KAFKA_BATCH_SIZE {
+		message, err := e.reader.FetchMessage(ctx)
+		if err != nil {
+			break
+		}
+		batch = append(batch, message)
+	}
+	return batch, nil
+}
+
+// retry calls do until it succeeds, reporting false when ctx is done first
+func (e *kafkaEnricher) retry(ctx context.Context, action string, do func() error) bool {
+	for attempt := 1; ; attempt++ {
+		err := do()
+		if err == nil {
+			return true
+		}
+
+		delay := kafkaRetry.backoff(attempt)
+		log.Error().Err(err).Msg(fmt.Sprintf("%s failed, retrying in %s (attempt %d)", action, delay.Round(time.Millisecond), attempt))
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+	}
+}
+
+// enrich returns the message with the lookup response (or batchErrorStruct) of its IP at the output field, and the
+// result counted in geoip_kafka_messages_total
+func (e *kafkaEnricher) enrich(ctx context.Context, value []byte) ([]byte, string) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	var message map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	// Keeps the large integers of the message as they are
+	decoder.UseNumber()
+	if err := decoder.Decode(&message); err != nil || message == nil {
+		return value, "invalid"
+	}
+
+	ipStr, ok := jsonPath(message, e.options.ipField).(string)
+	if !ok || ipStr == "" {
+		return value, "no_ip"
+	}
+	resp := batchResult(ctx, e.lookup, ipStr, nil, nil)
+	if !setJSONPath(message, e.options.outputField, resp) {
+		return value, "invalid"
+	}
+	enriched, err := json.Marshal(message)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return value, "invalid"
+	}
+
+	if _, failed := resp.(batchErrorStruct); failed {
+		return enriched, "lookup_failed"
+	}
+	return enriched, "enriched"
+}
+
+// jsonPath returns the value at the dot separated path of a JSON object, nil when missing
+func jsonPath(object map[string]interface{}, path string) interface{} {
+	var value interface{} = object
+	for _, key := range strings.Split(path, ".") {
+		parent, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = parent[key]
+	}
+	return value
+}
+
+// setJSONPath sets the value at the dot separated path of a JSON object, adding the missing objects on the way. It
+// reports false when another value is in the way.
+func setJSONPath(object map[string]interface{}, path string, value interface{}) bool {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := object[key]
+		if !ok {
+			child = map[string]interface{}{}
+			object[key] = child
+		}
+		if object, ok = child.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	object[keys[len(keys)-1]] = value
+	return true
+}
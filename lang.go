@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DEFAULT_LANGUAGE is used when none of the requested languages have a name
+const DEFAULT_LANGUAGE string = "en"
+
+// splitLanguages parses a comma separated list of languages (ex: "pt-BR,en"), by preference
+func splitLanguages(value string) []string {
+	var langs []string
+	for _, lang := range strings.Split(value, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// requestLanguages returns the languages to localize the names in, by preference, from ?lang= or else Accept-Language
+func requestLanguages(request *http.Request) []string {
+	if lang := request.URL.Query().Get("lang"); lang != "" {
+		return splitLanguages(lang)
+	}
+	return acceptList(request.Header.Get("Accept-Language"))
+}
+
+// acceptList parses an Accept or Accept-Language header (ex: "fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5") sorted by quality,
+// without the parameters
+func acceptList(header string) []string {
+	type weighted struct {
+		lang    string
+		quality float64
+	}
+
+	var langs []weighted
+	for _, lang := range splitLanguages(header) {
+		quality := 1.0
+		if i := strings.Index(lang, ";"); i >= 0 {
+			for _, param := range strings.Split(lang[i+1:], ";") {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+						quality = q
+					}
+				}
+			}
+			lang = strings.TrimSpace(lang[:i])
+		}
+		if lang == "*" || quality <= 0 {
+			continue
+		}
+		langs = append(langs, weighted{lang, quality})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].quality > langs[j].quality })
+
+	result := make([]string, len(langs))
+	for i, lang := range langs {
+		result[i] = lang.lang
+	}
+	return result
+}
+
+// localizedName returns the name in the first of langs available, matching "pt" with "pt-BR" and "zh-TW" with
+// "zh-CN" when there is no exact match, or else in English
+func localizedName(names map[string]string, langs []string) string {
+	for _, lang := range langs {
+		for code, name := range names {
+			if strings.EqualFold(code, lang) {
+				return name
+			}
+		}
+		base := strings.SplitN(lang, "-", 2)[0]
+		for code, name := range names {
+			if strings.EqualFold(strings.SplitN(code, "-", 2)[0], base) {
+				return name
+			}
+		}
+	}
+	return names[DEFAULT_LANGUAGE]
+}
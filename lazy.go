@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// lazyHandler answers the health checks, and 503 to the other routes, until serve is called with the handler of the
+// loaded databases. Used by --lazy-start to listen before the databases are downloaded.
+type lazyHandler struct {
+	loading http.Handler
+	handler atomic.Pointer[http.Handler]
+}
+
+func newLazyHandler(readiness httprouter.Handle) *lazyHandler {
+	loading := newRouter()
+	loading.GET("/healthz", metricsMiddleware("/healthz", healthCheckHandler))
+	loading.GET("/livez", metricsMiddleware("/livez", healthCheckHandler))
+	loading.GET("/readyz", readiness)
+	loading.GET("/metrics", metricsHandler())
+	loading.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		errResponse(w, http.StatusServiceUnavailable, ERR_DATABASES_LOADING, "Databases are loading")
+	})
+	loading.HandleMethodNotAllowed = false
+	return &lazyHandler{loading: loading}
+}
+
+// serve replaces the loading responses with handler
+func (h *lazyHandler) serve(handler http.Handler) {
+	h.handler.Store(&handler)
+}
+
+func (h *lazyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler := h.handler.Load(); handler != nil {
+		(*handler).ServeHTTP(w, r)
+		return
+	}
+	h.loading.ServeHTTP(w, r)
+}
+
+// loadDatabasesWithRetries is loadDatabases retried with the backoff of the updates (without the attempts limit) until
+// every database is loaded, or ctx is done
+func loadDatabasesWithRetries(ctx context.Context, databases []*maxmind, creds *maxmindCredentials, maxAge time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		accountId, license := creds.get()
+		err := loadDatabases(databases, accountId, license, maxAge)
+		if err == nil {
+			return nil
+		}
+
+		delay := updateRetry.backoff(attempt)
+		log.Error().Err(err).Msg(fmt.Sprintf("Loading the databases failed, retrying in %s (attempt %d)", delay.Round(time.Millisecond), attempt))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
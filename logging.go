@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// configureLogging sets the minimum level (ex: "debug") and the format of the logs: "json", or "console" for humans
+func configureLogging(level string, format string) error {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level '%s'", level)
+	}
+	zerolog.SetGlobalLevel(parsed)
+
+	switch format {
+	case "json":
+	case "console":
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+	default:
+		return fmt.Errorf("invalid log format '%s', expected 'json' or 'console'", format)
+	}
+	return nil
+}
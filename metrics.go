@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "geoip_http_requests_total",
+		Help: "HTTP requests by route and status code",
+	}, []string{"route", "code"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "geoip_http_request_duration_seconds",
+		Help:    "HTTP request latency by route",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"route"})
+	httpPanicsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "geoip_http_panics_total",
+		Help: "HTTP handler panics recovered with a 500 response",
+	})
+	requestsShedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "geoip_http_requests_shed_total",
+		Help: "API requests answered 503 by the load shedding, by route and reason: queue_full, queue_timeout or canceled",
+	}, []string{"route", "reason"})
+	requestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "geoip_http_requests_in_flight",
+		Help: "API requests being served, with --max-concurrent-requests",
+	})
+	kafkaMessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "geoip_kafka_messages_total",
+		Help: "Kafka messages enriched, by result: enriched, lookup_failed, no_ip, or invalid (not a JSON object, or another value at the output field)",
+	}, []string{"result"})
+	requestsQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "geoip_http_requests_queued",
+		Help: "API requests waiting for --max-concurrent-requests",
+	})
+	lookupErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "geoip_lookup_errors_total",
+		Help: "Database lookups that failed, by edition",
+	}, []string{"edition"})
+	databaseBuildEpoch = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "geoip_database_build_epoch_seconds",
+		Help: "Build time of the loaded database, by edition",
+	}, []string{"edition"})
+	databaseLastUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "geoip_database_last_update_success_seconds",
+		Help: "Time of the last successful database update, or check finding it up to date, by edition",
+	}, []string{"edition"})
+	databaseUpdateErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "geoip_database_update_errors_total",
+		Help: "Database fetches or reloads that failed, by edition",
+	}, []string{"edition"})
+	databaseUpdateAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "geoip_database_update_attempts_total",
+		Help: "Database update fetches by edition and result: updated, not_modified, retried or failed",
+	}, []string{"edition", "result"})
+	databaseUpdateDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "geoip_database_update_duration_seconds",
+		Help:    "Duration of the database updates, including their retries, by edition and result: loaded, updated, not_modified or failed",
+		Buckets: []float64{.1, .5, 1, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{"edition", "result"})
+	databaseLastUpdateAttempt = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "geoip_database_last_update_attempt_seconds",
+		Help: "Time of the last database update attempt, by edition",
+	}, []string{"edition"})
+	databaseLastUpdateFailed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "geoip_database_last_update_failed",
+		Help: "1 when the last database update attempt failed, by edition",
+	}, []string{"edition"})
+)
+
+// statusRecorder keeps the status code written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Hijack hands the connection over to the WebSocket route, counted as switching protocols
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// metricsMiddleware counts and times the requests of a route
+func metricsMiddleware(route string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(recorder, r, ps)
+
+		duration := time.Since(start)
+		code := strconv.Itoa(recorder.statusCode)
+		requestDuration.WithLabelValues(route).Observe(duration.Seconds())
+		requestsTotal.WithLabelValues(route, code).Inc()
+		statsd.timing("http.request_duration", duration, "route:"+route)
+		statsd.count("http.requests", "route:"+route, "code:"+code)
+	}
+}
+
+func metricsHandler() httprouter.Handle {
+	handler := promhttp.Handler()
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// registerAgeMetrics exposes the age of the database and of its last successful update, computed when scraped, to alert
+// on without PromQL arithmetic
+func (m *maxmind) registerAgeMetrics() {
+	labels := prometheus.Labels{"edition": m.edition}
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "geoip_database_age_seconds",
+		Help:        "Time since the build of the loaded database, by edition",
+		ConstLabels: labels,
+	}, func() float64 {
+		return time.Since(m.readiness().BuildTime).Seconds()
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "geoip_database_last_update_age_seconds",
+		Help:        "Time since the last successful database update, or check finding it up to date, by edition",
+		ConstLabels: labels,
+	}, func() float64 {
+		return time.Since(m.readiness().LastUpdate).Seconds()
+	})
+}
+
+// recordAttemptResult counts the outcome of an update fetch, after its retries
+func (m *maxmind) recordAttemptResult(result string) {
+	databaseUpdateAttemptsTotal.WithLabelValues(m.edition, result).Inc()
+	statsd.count("database.update_attempts", "edition:"+m.edition, "result:"+result)
+}
+
+// recordUpdate updates the database gauges after a successful fetch and reload
+func (m *maxmind) recordUpdate() {
+	db := m.acquire()
+	buildEpoch := db.Metadata().BuildEpoch
+	db.release()
+	databaseBuildEpoch.WithLabelValues(m.edition).Set(float64(buildEpoch))
+	databaseLastUpdate.WithLabelValues(m.edition).SetToCurrentTime()
+	statsd.count("database.updates", "edition:"+m.edition)
+	statsd.gauge("database.build_epoch", float64(buildEpoch), "edition:"+m.edition)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"github.com/swaggest/swgui/v5emb"
+)
+
+// OPENAPI_VERSION is the version of the OpenAPI specification of /openapi.json
+const OPENAPI_VERSION string = "3.0.3"
+
+// openAPIOptions are the options of serve changing the routes described
+type openAPIOptions struct {
+	// The API routes are described under the version, ex: /v1/geoip
+	version      string
+	prefix       string
+	batchMaxSize int
+	jsonp        bool
+	hostnames    bool
+	apiKeys      bool
+	// Whether the admin routes are on the main port, without --admin-bind and with --api-keys
+	admin bool
+}
+
+// openAPIBuilder builds the OpenAPI document of the routes, with the schemas of the responses reflected from their
+// structs
+type openAPIBuilder struct {
+	options openAPIOptions
+	schemas map[string]interface{}
+}
+
+// openAPIDocument describes the routes served for the loaded databases: the default lookup of the first one, and the
+// named lookups (ex: country, asn or an edition)
+func openAPIDocument(databases []*maxmind, lookupNames []string, options openAPIOptions) map[string]interface{} {
+	b := &openAPIBuilder{options: options, schemas: map[string]interface{}{}}
+	components := map[string]interface{}{
+		"schemas":    b.schemas,
+		"parameters": openAPIParameters(options),
+	}
+
+	ipDescription := "IP address (IPv4 or IPv6)"
+	if options.hostnames {
+		ipDescription = "IP address (IPv4 or IPv6) or hostname, resolved to its first address"
+	}
+	defaultType := reflect.TypeOf(databases[0].responseSample())
+	api := options.version + options.prefix
+	paths := map[string]interface{}{
+		api: map[string]interface{}{
+			"get": b.lookupOperation("Look up the client IP", defaultType, ""),
+		},
+		api + "/{ip}": map[string]interface{}{
+			"get": b.lookupOperation("Look up an IP", defaultType, ipDescription),
+		},
+		api + "/{ip}/{field}": map[string]interface{}{
+			"get": b.fieldOperation(defaultType, ipDescription),
+		},
+		api + "/batch": map[string]interface{}{
+			"post": b.batchOperation(defaultType, options.batchMaxSize),
+		},
+		options.version + "/ip": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "The client IP, as text unless JSON is asked for",
+				"parameters": []interface{}{openAPIRef("parameters", "format")},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "The client IP",
+						"content": map[string]interface{}{
+							"text/plain":       map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+							"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(ipResponseStruct{}))},
+						},
+					},
+				},
+			},
+		},
+		"/livez":   map[string]interface{}{"get": openAPIPublic(openAPIHealthOperation("Liveness check, the process is up"))},
+		"/healthz": map[string]interface{}{"get": openAPIPublic(openAPIHealthOperation("Liveness check, the process is up"))},
+		"/readyz": map[string]interface{}{
+			"get": openAPIPublic(b.operation("Readiness check, the databases are loaded and up to date", reflect.TypeOf(readinessStruct{}))),
+		},
+		"/dbinfo": map[string]interface{}{
+			"get": openAPIPublic(b.operation("Metadata of the loaded databases", reflect.TypeOf([]databaseInfoStruct{}))),
+		},
+		"/metrics": map[string]interface{}{
+			"get": openAPIPublic(map[string]interface{}{
+				"summary": "Prometheus metrics",
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "The metrics in the Prometheus text format",
+						"content":     map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+					},
+				},
+			}),
+		},
+	}
+	for _, name := range lookupNames {
+		responseType := defaultType
+		switch name {
+		case "asn":
+			responseType = reflect.TypeOf(asnResponseStruct{})
+		case "country":
+			responseType = reflect.TypeOf(countryResponseStruct{})
+		case "full":
+			responseType = reflect.TypeOf(geoResponseStruct{})
+		default:
+			for _, m := range databases {
+				if m.edition == name {
+					responseType = reflect.TypeOf(m.responseSample())
+				}
+			}
+		}
+		paths[api+"/"+name] = map[string]interface{}{
+			"get": b.lookupOperation("Look up the client IP in "+name, responseType, ""),
+		}
+		paths[api+"/"+name+"/{ip}"] = map[string]interface{}{
+			"get": b.lookupOperation("Look up an IP in "+name, responseType, ipDescription),
+		}
+	}
+	if options.admin {
+		editionParameter := openAPIRef("parameters", "edition")
+		// The updates run in the background, their outcome is in /admin/update-status
+		reload := b.adminOperation("Start downloading and reloading the databases", nil, editionParameter)
+		reload["responses"].(map[string]interface{})["202"] = openAPIJSONResponse("Started", b.schema(reflect.TypeOf([]databaseReadinessStruct{})))
+		paths["/admin/reload"] = map[string]interface{}{"post": reload}
+		paths["/admin/rollback"] = map[string]interface{}{
+			"post": b.adminOperation("Restore a kept previous database version", reflect.TypeOf(databaseInfoStruct{}), editionParameter,
+				map[string]interface{}{
+					"name": "build", "in": "query", "description": "Build epoch of the version, the previous one by default",
+					"schema": map[string]interface{}{"type": "integer"},
+				}),
+		}
+		paths["/admin/update-status"] = map[string]interface{}{
+			"get": b.adminOperation("The last update attempts of the databases", reflect.TypeOf(updateStatusStruct{}), editionParameter),
+		}
+		paths["/admin/cache-stats"] = map[string]interface{}{
+			"get": b.adminOperation("Statistics of the record cache", reflect.TypeOf([]cacheStatsStruct{})),
+		}
+	}
+	b.schema(reflect.TypeOf(problemStruct{}))
+
+	document := map[string]interface{}{
+		"openapi": OPENAPI_VERSION,
+		"info": map[string]interface{}{
+			"title":       "GeoIP Server",
+			"description": "IP geolocation lookups in the Maxmind databases. The unversioned API routes are aliases of the " + API_VERSION + " ones.",
+			"version":     API_VERSION,
+		},
+		"paths":      paths,
+		"components": components,
+	}
+	// The API keys are required by every route, except the health checks and metrics
+	if options.apiKeys {
+		components["securitySchemes"] = map[string]interface{}{
+			"apiKeyHeader": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			"apiKeyQuery":  map[string]interface{}{"type": "apiKey", "in": "query", "name": "api_key"},
+			"bearer":       map[string]interface{}{"type": "http", "scheme": "bearer"},
+		}
+		document["security"] = []interface{}{
+			map[string]interface{}{"apiKeyHeader": []string{}},
+			map[string]interface{}{"apiKeyQuery": []string{}},
+			map[string]interface{}{"bearer": []string{}},
+		}
+	}
+	return document
+}
+
+// openAPIParameters are the parameters shared by the routes
+func openAPIParameters(options openAPIOptions) map[string]interface{} {
+	formatNames := make([]string, 0, len(formats))
+	for name := range formats {
+		formatNames = append(formatNames, name)
+	}
+	sort.Strings(formatNames)
+	parameters := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"name": "fields", "in": "query", "style": "form", "explode": false,
+			"description": "Fields of the response to return, all of them when empty. A field the response does not have is a 400.",
+			"schema":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+		"lang": map[string]interface{}{
+			"name": "lang", "in": "query",
+			"description": "Languages of the names, comma separated by preference, otherwise from Accept-Language",
+			"schema":      map[string]interface{}{"type": "string", "example": "pt-BR,en"},
+		},
+		"format": map[string]interface{}{
+			"name": "format", "in": "query",
+			"description": "Format of the response, otherwise negotiated with the Accept header",
+			"schema":      map[string]interface{}{"type": "string", "enum": formatNames, "default": "json"},
+		},
+		"edition": map[string]interface{}{
+			"name": "edition", "in": "query",
+			"description": "Only this edition, all of them otherwise",
+			"schema":      map[string]interface{}{"type": "string"},
+		},
+	}
+	if options.jsonp {
+		parameters["callback"] = map[string]interface{}{
+			"name": "callback", "in": "query",
+			"description": "Function to wrap the JSON response in a call to (JSONP)",
+			"schema":      map[string]interface{}{"type": "string"},
+		}
+	}
+	if options.hostnames {
+		parameters["family"] = map[string]interface{}{
+			"name": "family", "in": "query",
+			"description": "Address family of the hostname resolution",
+			"schema":      map[string]interface{}{"type": "string", "enum": []string{"ipv4", "ipv6"}},
+		}
+	}
+	return parameters
+}
+
+// lookupOperation describes a lookup route, of the IP path parameter when ipDescription is set
+func (b *openAPIBuilder) lookupOperation(summary string, responseType reflect.Type, ipDescription string) map[string]interface{} {
+	var parameters []interface{}
+	if ipDescription != "" {
+		parameters = append(parameters, map[string]interface{}{
+			"name": "ip", "in": "path", "required": true, "description": ipDescription,
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	operation := b.operation(summary, responseType)
+	operation["parameters"] = append(parameters, b.lookupParameters()...)
+	return operation
+}
+
+// fieldOperation describes the route of a single field of the response, as text
+func (b *openAPIBuilder) fieldOperation(responseType reflect.Type, ipDescription string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	b.properties(responseType, properties)
+	fields := make([]string, 0, len(properties))
+	for field := range properties {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return map[string]interface{}{
+		"summary": "A single field of the response of an IP, as text",
+		"parameters": []interface{}{
+			map[string]interface{}{
+				"name": "ip", "in": "path", "required": true, "description": ipDescription,
+				"schema": map[string]interface{}{"type": "string"},
+			},
+			map[string]interface{}{
+				"name": "field", "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string", "enum": fields},
+			},
+			openAPIRef("parameters", "lang"),
+		},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "The value of the field",
+				"content":     map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+			},
+			"default": openAPIProblemResponse(),
+		},
+	}
+}
+
+// batchOperation describes the lookup of a JSON array of IPs
+func (b *openAPIBuilder) batchOperation(responseType reflect.Type, maxSize int) map[string]interface{} {
+	operation := b.operation("Look up up to "+strconv.Itoa(maxSize)+" IPs at once, in the same order", nil)
+	operation["requestBody"] = map[string]interface{}{
+		"required": true,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type": "array", "maxItems": maxSize, "items": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+	}
+	operation["responses"].(map[string]interface{})["200"] = openAPIJSONResponse("The results, an error for the IPs that failed", map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"oneOf": []interface{}{b.schema(responseType), b.schema(reflect.TypeOf(batchErrorStruct{}))},
+		},
+	})
+	operation["parameters"] = b.lookupParameters()
+	return operation
+}
+
+// adminOperation describes an admin route, authenticated like the API
+func (b *openAPIBuilder) adminOperation(summary string, responseType reflect.Type, parameters ...interface{}) map[string]interface{} {
+	operation := b.operation(summary, responseType)
+	operation["tags"] = []string{"admin"}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	return operation
+}
+
+// operation describes a route responding with the JSON of responseType, or a problem document
+func (b *openAPIBuilder) operation(summary string, responseType reflect.Type) map[string]interface{} {
+	responses := map[string]interface{}{"default": openAPIProblemResponse()}
+	if responseType != nil {
+		responses["200"] = openAPIJSONResponse("Success", b.schema(responseType))
+	}
+	return map[string]interface{}{"summary": summary, "responses": responses}
+}
+
+func (b *openAPIBuilder) lookupParameters() []interface{} {
+	parameters := []interface{}{
+		openAPIRef("parameters", "fields"),
+		openAPIRef("parameters", "lang"),
+		openAPIRef("parameters", "format"),
+	}
+	if b.options.jsonp {
+		parameters = append(parameters, openAPIRef("parameters", "callback"))
+	}
+	if b.options.hostnames {
+		parameters = append(parameters, openAPIRef("parameters", "family"))
+	}
+	return parameters
+}
+
+// schema returns the JSON schema of a type, the structs being referenced as components named after them (ex:
+// geoResponseStruct is GeoResponse)
+func (b *openAPIBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		name := strings.TrimSuffix(t.Name(), "Struct")
+		name = strings.ToUpper(name[:1]) + name[1:]
+		if _, ok := b.schemas[name]; !ok {
+			// Set before the properties, for the recursive types
+			b.schemas[name] = nil
+			properties := map[string]interface{}{}
+			b.properties(t, properties)
+			b.schemas[name] = map[string]interface{}{"type": "object", "properties": properties}
+		}
+		return openAPIRef("schemas", name)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// properties adds the JSON fields of a struct to properties, including the ones of its embedded structs
+func (b *openAPIBuilder) properties(t reflect.Type, properties map[string]interface{}) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			b.properties(field.Type, properties)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+	}
+}
+
+// responseSample is a zero response of the lookups of the database, for its schema
+func (m *maxmind) responseSample() interface{} {
+	switch {
+	case m.isISP():
+		return ispResponseStruct{}
+	case m.isASN() && !m.isCity():
+		return asnResponseStruct{}
+	case m.isAnonymousIP():
+		return anonymousIPResponseStruct{}
+	case m.isDomain():
+		return domainResponseStruct{}
+	default:
+		return geoResponseStruct{}
+	}
+}
+
+func openAPIRef(kind string, name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/" + kind + "/" + name}
+}
+
+func openAPIJSONResponse(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+	}
+}
+
+func openAPIProblemResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Error, with a machine-readable code",
+		"content":     map[string]interface{}{PROBLEM_CONTENT_TYPE: map[string]interface{}{"schema": openAPIRef("schemas", "Problem")}},
+	}
+}
+
+// openAPIPublic marks an operation as not requiring the API keys
+func openAPIPublic(operation map[string]interface{}) map[string]interface{} {
+	operation["security"] = []interface{}{}
+	return operation
+}
+
+func openAPIHealthOperation(summary string) map[string]interface{} {
+	return map[string]interface{}{
+		"summary":   summary,
+		"responses": map[string]interface{}{"200": map[string]interface{}{"description": "Up"}},
+	}
+}
+
+// openAPIHandler serves the OpenAPI document, encoded once
+func openAPIHandler(document map[string]interface{}) httprouter.Handle {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	body, err := json.Marshal(document)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	return func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body); err != nil {
+			log.Error().Err(err).Msg("")
+		}
+	}
+}
+
+// swaggerUIHandler serves the embedded Swagger UI of /openapi.json under /docs/
+func swaggerUIHandler() httprouter.Handle {
+	handler := v5emb.New("GeoIP Server", "/openapi.json", "/docs/")
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		handler.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,298 @@
+// Package geoip downloads, verifies and hot swaps Maxmind databases, for embedding the lookups of geoip-server
+// in other Go services.
+package geoip
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// updateURL is the Maxmind update endpoint of an edition, answering 304 when it has the same database as the MD5
+const updateURL string = "https://updates.maxmind.com/geoip/databases/%s/update?db_md5=%s"
+
+// Magic ("ustar") of the tar archives, at TAR_MAGIC_OFFSET of its first header
+const (
+	TAR_MAGIC        string = "ustar"
+	TAR_MAGIC_OFFSET int    = 257
+)
+
+// ErrNotModified is returned when fetching a database that is the same as the loaded one
+var ErrNotModified = errors.New("database not modified")
+
+// StatusError is returned when Maxmind answers the download with an unexpected status (ex: 401 for an invalid license)
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("download failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// ErrChecksum is returned when a downloaded database does not have the expected checksum, ex: corrupted in transit
+var ErrChecksum = errors.New("database checksum mismatch")
+
+// ParseChecksums returns the Checksums of the values "[edition=]checksum", where the checksum is "md5:<hex>",
+// "sha256:<hex>" or the hex alone. Without an edition, it is the checksum of any edition.
+func ParseChecksums(values []string) (map[string]string, error) {
+	checksums := map[string]string{}
+	for _, value := range values {
+		edition, checksum := "", value
+		if i := strings.Index(value, "="); i >= 0 {
+			edition, checksum = value[:i], value[i+1:]
+		}
+		if _, _, err := parseChecksum(checksum); err != nil {
+			return nil, err
+		}
+		checksums[edition] = checksum
+	}
+	return checksums, nil
+}
+
+// parseChecksum returns the algorithm ("md5" or "sha256") and hex value of a checksum, guessed from its length when
+// without the algorithm
+func parseChecksum(checksum string) (string, string, error) {
+	algorithm, value := "", checksum
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algorithm, value = strings.ToLower(checksum[:i]), checksum[i+1:]
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return "", "", fmt.Errorf("invalid checksum '%s', expected hexadecimal", checksum)
+	}
+	switch {
+	case (algorithm == "" || algorithm == "md5") && len(value) == md5.Size*2:
+		return "md5", value, nil
+	case (algorithm == "" || algorithm == "sha256") && len(value) == sha256.Size*2:
+		return "sha256", value, nil
+	}
+	return "", "", fmt.Errorf("invalid checksum '%s', expected md5:<hex> or sha256:<hex>", checksum)
+}
+
+// MD5 is the checksum Maxmind uses to tell whether a database changed
+func MD5(db []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(db))
+}
+
+// Downloader downloads the editions from Maxmind, the zero value with http.DefaultClient
+type Downloader struct {
+	// Client of the downloads, http.DefaultClient when nil (without a timeout)
+	Client *http.Client
+	// Expected checksums of the databases by edition, or "" for any, see ParseChecksums
+	Checksums map[string]string
+	// URL of the downloads with {edition} and {md5} replaced, ex: of an internal mirror or an S3 presigned URL.
+	// The Maxmind update endpoint when empty.
+	URL string
+}
+
+// NewClient returns an HTTP client for the downloads timing out after timeout, and tlsHandshakeTimeout for the TLS
+// handshake (none when 0). The requests go through proxy (ex: http://proxy:3128) when set, otherwise the one of the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func NewClient(timeout time.Duration, tlsHandshakeTimeout time.Duration, proxy string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy '%s': %w", proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// Download downloads the edition with the zero Downloader
+func Download(ctx context.Context, edition string, accountId string, license string, currentMD5 string) ([]byte, error) {
+	return (&Downloader{}).Download(ctx, edition, accountId, license, currentMD5)
+}
+
+// Download downloads the edition, returning ErrNotModified when its MD5 is currentMD5
+func (d *Downloader) Download(ctx context.Context, edition string, accountId string, license string, currentMD5 string) ([]byte, error) {
+	var db []byte
+	sum, err := d.download(ctx, edition, accountId, license, currentMD5, func(reader io.Reader) error {
+		var err error
+		db, err = ioutil.ReadAll(reader)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Mirrors may answer with the database regardless of the MD5
+	if sum == currentMD5 {
+		return nil, ErrNotModified
+	}
+	return db, nil
+}
+
+// FileMD5 is the MD5 of a database file, without reading it in memory
+func FileMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// DownloadFile is Download streamed to a temporary file of dir (the system one when empty) instead of memory, synced
+// to disk, for OpenFile. It returns the path of the file, to remove or rename once opened, and its MD5.
+func (d *Downloader) DownloadFile(ctx context.Context, edition string, accountId string, license string, currentMD5 string, dir string) (string, string, error) {
+	file, err := ioutil.TempFile(dir, edition+".*.tmp")
+	if err != nil {
+		return "", "", err
+	}
+	sum, err := d.download(ctx, edition, accountId, license, currentMD5, func(reader io.Reader) error {
+		_, err := io.Copy(file, reader)
+		return err
+	})
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && sum == currentMD5 {
+		err = ErrNotModified
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", "", err
+	}
+	return file.Name(), sum, nil
+}
+
+// FetchFile returns the database file at path when set, otherwise downloads the edition with DownloadFile, with its
+// MD5. ErrNotModified is returned when it is the same as currentMD5.
+func (d *Downloader) FetchFile(ctx context.Context, edition string, path string, accountId string, license string, currentMD5 string, dir string) (string, string, error) {
+	if path == "" {
+		return d.DownloadFile(ctx, edition, accountId, license, currentMD5, dir)
+	}
+	sum, err := FileMD5(path)
+	if err != nil {
+		return "", "", err
+	}
+	if sum == currentMD5 {
+		return "", "", ErrNotModified
+	}
+	return path, sum, nil
+}
+
+// download requests the edition and calls read with the database, unpacked. The database is verified against the MD5
+// sent by Maxmind and the expected checksum of the edition, returning its MD5.
+func (d *Downloader) download(ctx context.Context, edition string, accountId string, license string, currentMD5 string, read func(reader io.Reader) error) (string, error) {
+	if currentMD5 == "" {
+		// Like geoipupdate, as that never matches a database
+		currentMD5 = strings.Repeat("0", 32)
+	}
+	downloadURL := fmt.Sprintf(updateURL, edition, currentMD5)
+	if d.URL != "" {
+		downloadURL = strings.NewReplacer("{edition}", url.PathEscape(edition), "{md5}", currentMD5).Replace(d.URL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return "", err
+	}
+	// Mirrors may not need it, and presigned URLs fail with another authorization
+	if license != "" {
+		req.SetBasicAuth(accountId, license)
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return "", ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	// Maxmind serves it gzipped, mirrors may serve the .mmdb as is
+	body := bufio.NewReader(resp.Body)
+	var reader io.Reader = body
+	if magic, _ := body.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzr, err := gzip.NewReader(body)
+		if err != nil {
+			return "", err
+		}
+		defer gzr.Close()
+		reader = gzr
+	}
+	// The permalinks serve a tar.gz with the .mmdb, the license and copyright files
+	archive := bufio.NewReader(reader)
+	reader = archive
+	if header, err := archive.Peek(TAR_MAGIC_OFFSET + len(TAR_MAGIC)); err == nil && string(header[TAR_MAGIC_OFFSET:]) == TAR_MAGIC {
+		if reader, err = mmdbFromTar(archive); err != nil {
+			return "", err
+		}
+	}
+
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if err := read(io.TeeReader(reader, io.MultiWriter(md5Hash, sha256Hash))); err != nil {
+		return "", err
+	}
+	sum := fmt.Sprintf("%x", md5Hash.Sum(nil))
+
+	// The MD5 of the database, sent by the update endpoint
+	if expected := resp.Header.Get("X-Database-MD5"); expected != "" && !strings.EqualFold(expected, sum) {
+		return "", fmt.Errorf("%w: expected md5 %s, got %s", ErrChecksum, expected, sum)
+	}
+	expected, ok := d.Checksums[edition]
+	if !ok {
+		expected = d.Checksums[""]
+	}
+	if expected != "" {
+		algorithm, value, _ := parseChecksum(expected)
+		actual := sum
+		if algorithm == "sha256" {
+			actual = fmt.Sprintf("%x", sha256Hash.Sum(nil))
+		}
+		if !strings.EqualFold(value, actual) {
+			return "", fmt.Errorf("%w: expected %s %s, got %s", ErrChecksum, algorithm, value, actual)
+		}
+	}
+	return sum, nil
+}
+
+// mmdbFromTar returns the reader of the .mmdb file in the tar archive, ex: GeoLite2-City_20240102/GeoLite2-City.mmdb
+func mmdbFromTar(archive io.Reader) (io.Reader, error) {
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("no .mmdb file in the downloaded archive")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && strings.HasSuffix(header.Name, ".mmdb") {
+			return tr, nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package geoip
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The downloads are not opened, any content stands for the database
+var testDatabase = []byte("not a real database, but its checksums are")
+
+func testTarGz(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	gzw := gzip.NewWriter(&buffer)
+	tw := tar.NewWriter(gzw)
+	// The license files come first in the Maxmind archives
+	for _, name := range []string{"GeoLite2-City_20240102/LICENSE.txt", "GeoLite2-City_20240102/GeoLite2-City.mmdb"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func testGzip(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	gzw := gzip.NewWriter(&buffer)
+	if _, err := gzw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestParseChecksums(t *testing.T) {
+	md5Sum := MD5(testDatabase)
+	sha256Sum := fmt.Sprintf("%x", sha256.Sum256(testDatabase))
+
+	checksums, err := ParseChecksums([]string{"md5:" + md5Sum, "GeoLite2-City=sha256:" + sha256Sum, "GeoLite2-ASN=" + md5Sum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"": "md5:" + md5Sum, "GeoLite2-City": "sha256:" + sha256Sum, "GeoLite2-ASN": md5Sum}
+	if fmt.Sprint(checksums) != fmt.Sprint(expected) {
+		t.Errorf("got %v, expected %v", checksums, expected)
+	}
+
+	for _, value := range []string{
+		"md5:xyz",
+		"md5:" + md5Sum[:31],
+		"sha256:" + md5Sum,
+		"md5:" + sha256Sum,
+		"sha1:" + md5Sum,
+		"GeoLite2-City=",
+		"GeoLite2-City=md5:" + md5Sum + " GeoLite2-City.mmdb",
+	} {
+		if _, err := ParseChecksums([]string{value}); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	sha256Sum := fmt.Sprintf("%x", sha256.Sum256(testDatabase))
+	tarGz := testTarGz(t, map[string][]byte{
+		"GeoLite2-City_20240102/LICENSE.txt":        []byte("license"),
+		"GeoLite2-City_20240102/GeoLite2-City.mmdb": testDatabase,
+	})
+	withoutDatabase := testTarGz(t, map[string][]byte{"GeoLite2-City_20240102/LICENSE.txt": []byte("license")})
+
+	tests := []struct {
+		name      string
+		body      []byte
+		md5Header string
+		checksums map[string]string
+		err       error
+	}{
+		{"mmdb", testDatabase, "", nil, nil},
+		{"gzip", testGzip(t, testDatabase), MD5(testDatabase), nil, nil},
+		{"tar.gz", tarGz, "", map[string]string{"GeoLite2-City": "sha256:" + sha256Sum}, nil},
+		{"any edition checksum", tarGz, "", map[string]string{"": MD5(testDatabase), "GeoLite2-ASN": "md5:" + MD5(nil)}, nil},
+		{"md5 header mismatch", tarGz, MD5(nil), nil, ErrChecksum},
+		{"checksum mismatch", tarGz, "", map[string]string{"GeoLite2-City": "sha256:" + fmt.Sprintf("%x", sha256.Sum256(nil))}, ErrChecksum},
+		{"edition checksum first", testDatabase, "", map[string]string{"": MD5(testDatabase), "GeoLite2-City": "md5:" + MD5(nil)}, ErrChecksum},
+		{"tar.gz without database", withoutDatabase, "", nil, errors.New("no .mmdb file in the downloaded archive")},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if test.md5Header != "" {
+				w.Header().Set("X-Database-MD5", test.md5Header)
+			}
+			w.Write(test.body)
+		}))
+		downloader := &Downloader{Client: server.Client(), URL: server.URL + "/{edition}", Checksums: test.checksums}
+		db, err := downloader.Download(context.Background(), "GeoLite2-City", "", "", "")
+		server.Close()
+
+		switch {
+		case test.err == nil && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.err == nil && !bytes.Equal(db, testDatabase):
+			t.Errorf("%s: got %q, expected the database", test.name, db)
+		case test.err != nil && err == nil:
+			t.Errorf("%s: expected the error '%v'", test.name, test.err)
+		case errors.Is(test.err, ErrChecksum) && !errors.Is(err, ErrChecksum):
+			t.Errorf("%s: got '%v', expected a checksum mismatch", test.name, err)
+		case test.err != nil && !errors.Is(test.err, ErrChecksum) && err.Error() != test.err.Error():
+			t.Errorf("%s: got '%v', expected '%v'", test.name, err, test.err)
+		}
+	}
+}
+
+func TestDownloadNotModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testGzip(t, testDatabase))
+	}))
+	defer server.Close()
+
+	// Mirrors answer with the database regardless of the MD5
+	downloader := &Downloader{Client: server.Client(), URL: server.URL + "/{edition}?md5={md5}"}
+	if _, err := downloader.Download(context.Background(), "GeoLite2-City", "", "", MD5(testDatabase)); !errors.Is(err, ErrNotModified) {
+		t.Errorf("got '%v', expected ErrNotModified", err)
+	}
+}
@@ -0,0 +1,67 @@
+package geoip
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Request headers set by the Middleware with Config.Headers
+const (
+	HEADER_COUNTRY_CODE string = "X-Geoip-Country-Code"
+	HEADER_CITY         string = "X-Geoip-City"
+)
+
+type contextKey struct{}
+
+// FromContext returns the city record of the client set by the Middleware, nil when it could not be looked up
+func FromContext(ctx context.Context) *geoip2.City {
+	city, _ := ctx.Value(contextKey{}).(*geoip2.City)
+	return city
+}
+
+// Middleware looks up the client of every request, next gets the record with FromContext and, with Config.Headers,
+// the country code and English city name in request headers. Requests that could not be looked up are passed as is.
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.Headers {
+			// Never trust the ones sent by the client
+			r.Header.Del(HEADER_COUNTRY_CODE)
+			r.Header.Del(HEADER_CITY)
+		}
+
+		ip := s.clientIP(r)
+		if ip == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		city, err := s.Lookup(r.Context(), ip)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.config.Headers {
+			if city.Country.IsoCode != "" {
+				r.Header.Set(HEADER_COUNTRY_CODE, city.Country.IsoCode)
+			}
+			if name := city.City.Names["en"]; name != "" {
+				r.Header.Set(HEADER_CITY, name)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, city)))
+	})
+}
+
+func (s *Service) clientIP(r *http.Request) net.IP {
+	if s.config.ClientIP != nil {
+		return s.config.ClientIP(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
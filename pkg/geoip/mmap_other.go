@@ -0,0 +1,16 @@
+//go:build !unix
+
+package geoip
+
+import (
+	"os"
+)
+
+// mapFile reads the file in memory, where memory-mapping it is not implemented
+func mapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func unmapFile(_ []byte) error {
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package geoip
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile memory-maps the file read-only: the OS pages it in on demand, sharing the page cache with the other
+// processes reading it
+func mapFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// Not mappable, rejected as an invalid database
+	if info.Size() == 0 {
+		return nil, nil
+	}
+	return unix.Mmap(int(file.Fd()), 0, int(info.Size()), unix.PROT_READ, unix.MAP_SHARED)
+}
+
+func unmapFile(mapping []byte) error {
+	if mapping == nil {
+		return nil
+	}
+	return unix.Munmap(mapping)
+}
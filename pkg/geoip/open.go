@@ -0,0 +1,80 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Open opens a fetched database and checks its metadata is of edition, when set, and a test lookup, so a corrupt or
+// truncated download is never swapped in. Both readers are of the same database, the maxminddb one is for what
+// geoip2 does not expose (ex: the matched networks).
+func Open(db []byte, edition string) (*geoip2.Reader, *maxminddb.Reader, error) {
+	mmdb, err := maxminddb.FromBytes(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := geoip2.FromBytes(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := check(reader, edition); err != nil {
+		return nil, nil, err
+	}
+	return reader, mmdb, nil
+}
+
+// Database is a database file opened by OpenFile, memory-mapped once for both its readers
+type Database struct {
+	*geoip2.Reader
+	// The same database, for what geoip2 does not expose (ex: the matched networks)
+	MMDB    *maxminddb.Reader
+	mapping []byte
+}
+
+// Close unmaps the file, the readers must not be used anymore
+func (d *Database) Close() error {
+	mapping := d.mapping
+	d.mapping = nil
+	return unmapFile(mapping)
+}
+
+// OpenFile is Open for a database file, memory-mapped instead of read in memory (ex: by DownloadFile). The file must
+// be replaced by renaming another one over it, not written in place, while it is open.
+func OpenFile(path string, edition string) (*Database, error) {
+	mapping, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, mmdb, err := Open(mapping, edition)
+	if err != nil {
+		unmapFile(mapping)
+		return nil, err
+	}
+	return &Database{Reader: reader, MMDB: mmdb, mapping: mapping}, nil
+}
+
+// check checks that the database is of the edition, when set, and that a lookup works
+func check(reader *geoip2.Reader, edition string) error {
+	databaseType := reader.Metadata().DatabaseType
+	if edition != "" && databaseType != edition {
+		return fmt.Errorf("expected edition '%s', got '%s'", edition, databaseType)
+	}
+
+	// A test lookup, with whichever lookup the database supports
+	testIP := net.ParseIP("1.1.1.1")
+	_, cityErr := reader.City(testIP)
+	_, asnErr := reader.ASN(testIP)
+	_, anonymousErr := reader.AnonymousIP(testIP)
+	_, ispErr := reader.ISP(testIP)
+	_, domainErr := reader.Domain(testIP)
+	for _, err := range []error{cityErr, asnErr, anonymousErr, ispErr, domainErr} {
+		if err != nil && !errors.As(err, &geoip2.InvalidMethodError{}) {
+			return fmt.Errorf("test lookup failed: %w", err)
+		}
+	}
+	return nil
+}
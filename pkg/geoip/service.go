@@ -0,0 +1,174 @@
+package geoip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ErrNotLoaded is returned by the lookups of a Service that was not started
+var ErrNotLoaded = errors.New("database not loaded")
+
+// Config of a Service. The database is read from Path when set, otherwise the edition is downloaded from Maxmind
+// with the account ID and license.
+type Config struct {
+	Edition   string
+	Path      string
+	AccountID string
+	License   string
+	// Interval to check for database updates (or re-read Path), 24 hours when 0
+	UpdateInterval time.Duration
+	// Called with the errors of the periodic updates, the loaded database is kept meanwhile
+	OnUpdateError func(err error)
+	// Downloader of the edition (ex: with a client from NewClient), the zero one when nil
+	Downloader *Downloader
+
+	// Whether the Middleware also sets the HEADER_COUNTRY_CODE and HEADER_CITY request headers
+	Headers bool
+	// The IP the Middleware looks up, the remote address when nil (ex: for a proxy, the X-Forwarded-For one)
+	ClientIP func(r *http.Request) net.IP
+}
+
+// Service is an auto-updating database: the update is swapped in without interrupting the lookups
+type Service struct {
+	config   Config
+	mutex    sync.RWMutex
+	updating sync.Mutex
+	reader   *Database
+	md5      string
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func New(config Config) *Service {
+	if config.Edition == "" && config.Path == "" {
+		config.Edition = "GeoLite2-City"
+	}
+	if config.UpdateInterval == 0 {
+		config.UpdateInterval = 24 * time.Hour
+	}
+	if config.Downloader == nil {
+		config.Downloader = &Downloader{}
+	}
+	return &Service{config: config}
+}
+
+// Start loads the database, then updates it every UpdateInterval until Stop
+func (s *Service) Start(ctx context.Context) error {
+	if err := s.update(ctx); err != nil {
+		return err
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.config.UpdateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := s.Update(context.Background()); err != nil && s.config.OnUpdateError != nil {
+					s.config.OnUpdateError(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends the updates and closes the database
+func (s *Service) Stop() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.reader == nil {
+		return nil
+	}
+	err := s.reader.Close()
+	s.reader = nil
+	return err
+}
+
+// Update fetches the database and swaps it in when it changed
+func (s *Service) Update(ctx context.Context) error {
+	err := s.update(ctx)
+	if errors.Is(err, ErrNotModified) {
+		return nil
+	}
+	return err
+}
+
+func (s *Service) update(ctx context.Context) error {
+	s.updating.Lock()
+	defer s.updating.Unlock()
+
+	s.mutex.RLock()
+	currentMD5 := s.md5
+	s.mutex.RUnlock()
+
+	// The file is memory-mapped. The downloads are streamed to a temporary one, not to hold the database twice in
+	// memory, unlinked once mapped (freeing the disk space once closed).
+	path, newMD5, err := s.config.Downloader.FetchFile(ctx, s.config.Edition, s.config.Path, s.config.AccountID, s.config.License, currentMD5, "")
+	if err != nil {
+		return err
+	}
+	if s.config.Path == "" {
+		defer os.Remove(path)
+	}
+
+	reader, err := OpenFile(path, s.config.Edition)
+	if err != nil {
+		return err
+	}
+
+	// The lookups hold the read lock, so none is using the old reader once the write lock is acquired
+	s.mutex.Lock()
+	oldReader := s.reader
+	s.reader = reader
+	s.md5 = newMD5
+	s.mutex.Unlock()
+	if oldReader != nil {
+		return oldReader.Close()
+	}
+	return nil
+}
+
+// Lookup returns the city record of ip, with its country, subdivisions, location and names. It is empty when the
+// database has no record for ip.
+func (s *Service) Lookup(ctx context.Context, ip net.IP) (*geoip2.City, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.reader == nil {
+		return nil, ErrNotLoaded
+	}
+	return s.reader.City(ip)
+}
+
+// Metadata of the loaded database, ex: its edition (DatabaseType) and BuildEpoch
+func (s *Service) Metadata() (maxminddb.Metadata, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.reader == nil {
+		return maxminddb.Metadata{}, ErrNotLoaded
+	}
+	return s.reader.Metadata(), nil
+}
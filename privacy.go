@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net"
+)
+
+// How the IPs are written in the logs, see --log-ips
+const (
+	LOG_IPS_FULL     string = "full"
+	LOG_IPS_TRUNCATE string = "truncate"
+	LOG_IPS_HASH     string = "hash"
+)
+
+var (
+	logIPsMode = LOG_IPS_FULL
+	// Random per process, so the hashes can't be reversed by hashing every IPv4
+	logIPsSalt = make([]byte, 16)
+)
+
+// setLogIPs sets how logIP writes the IPs
+func setLogIPs(mode string) error {
+	switch mode {
+	case LOG_IPS_FULL, LOG_IPS_TRUNCATE:
+	case LOG_IPS_HASH:
+		if _, err := rand.Read(logIPsSalt); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid --log-ips '%s', expected 'full', 'truncate' or 'hash'", mode)
+	}
+	logIPsMode = mode
+	return nil
+}
+
+// logIP returns ipStr as it may be logged: as is, truncated to its /24 (IPv4) or /48 (IPv6) network, ex: "81.2.69.0",
+// or hashed. Values that are not IPs are redacted too when truncating, as they may still contain one.
+func logIP(ipStr string) string {
+	switch logIPsMode {
+	case LOG_IPS_TRUNCATE:
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			return "[redacted]"
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	case LOG_IPS_HASH:
+		hash := sha256.Sum256(append(append([]byte{}, logIPsSalt...), ipStr...))
+		return fmt.Sprintf("%x", hash[:8])
+	default:
+		return ipStr
+	}
+}
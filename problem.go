@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// PROBLEM_CONTENT_TYPE is the media type of the error responses (RFC 7807)
+const PROBLEM_CONTENT_TYPE string = "application/problem+json"
+
+// The machine-readable codes of the error responses, for the clients to branch on
+const (
+	ERR_INVALID_IP           string = "invalid_ip"
+	ERR_HOSTNAME_UNRESOLVED  string = "hostname_unresolved"
+	ERR_IP_NOT_FOUND         string = "ip_not_found"
+	ERR_BOGON_IP             string = "bogon_ip"
+	ERR_LOOKUP_FAILED        string = "lookup_failed"
+	ERR_UNKNOWN_FIELD        string = "unknown_field"
+	ERR_UNSUPPORTED_FORMAT   string = "unsupported_format"
+	ERR_FIELDS_NOT_SUPPORTED string = "fields_not_supported"
+	ERR_INVALID_CALLBACK     string = "invalid_callback"
+	ERR_INVALID_BATCH        string = "invalid_batch"
+	ERR_BATCH_TOO_LARGE      string = "batch_too_large"
+	ERR_UNAUTHORIZED         string = "unauthorized"
+	ERR_EDITION_NOT_LOADED   string = "edition_not_loaded"
+	ERR_INVALID_BUILD        string = "invalid_build"
+	ERR_ROLLBACK_FAILED      string = "rollback_failed"
+	ERR_UPDATE_RUNNING       string = "update_running"
+	ERR_DATABASES_LOADING    string = "databases_loading"
+	ERR_NOT_FOUND            string = "not_found"
+	ERR_METHOD_NOT_ALLOWED   string = "method_not_allowed"
+	ERR_INTERNAL             string = "internal_error"
+	ERR_OVERLOADED           string = "overloaded"
+	ERR_WEBSOCKET_HANDSHAKE  string = "websocket_handshake_failed"
+)
+
+// problemStruct is an RFC 7807 problem document
+type problemStruct struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	// The detail, or else the title, as in the {"error": "..."} responses before the problem documents
+	Error string `json:"error"`
+}
+
+// newRouter returns a router answering the unknown routes, the methods not allowed (with the Allow header) and the
+// handler panics with problem documents, instead of the plain text net/http errors
+func newRouter() *httprouter.Router {
+	router := httprouter.New()
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		errResponse(w, http.StatusNotFound, ERR_NOT_FOUND, "Unknown route")
+	})
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errResponse(w, http.StatusMethodNotAllowed, ERR_METHOD_NOT_ALLOWED, fmt.Sprintf("Method %s not allowed, expected %s", r.Method, w.Header().Get("Allow")))
+	})
+	router.PanicHandler = handlePanic
+	return router
+}
+
+// errResponse writes the problem document of an error, with the status code and the machine-readable code, and the
+// message for humans (the status text when empty)
+func errResponse(w http.ResponseWriter, statusCode int, code string, message string) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	problem := problemStruct{
+		Type:   "about:blank",
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: message,
+		Code:   code,
+		Error:  message,
+	}
+	if problem.Error == "" {
+		problem.Error = problem.Title
+	}
+	body, err := json.Marshal(problem)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+
+	w.Header().Set("Content-Type", PROBLEM_CONTENT_TYPE)
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Error().Err(err).Msg("")
+	}
+}
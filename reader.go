@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"geoip-server/pkg/geoip"
+	"github.com/rs/zerolog/log"
+)
+
+// sharedReader is a database reader shared by the in-flight lookups. The maxmind holding it owns one reference
+// and every lookup acquires another, so once replaced it is closed when the last lookup using it is done.
+type sharedReader struct {
+	*geoip.Database
+	refs  int32
+	cache *recordCache
+	md5   string
+}
+
+func newSharedReader(db *geoip.Database, cache *recordCache, md5 string) *sharedReader {
+	return &sharedReader{Database: db, refs: 1, cache: cache, md5: md5}
+}
+
+// release drops a reference, closing the reader when it was the last one
+func (r *sharedReader) release() {
+	if atomic.AddInt32(&r.refs, -1) == 0 {
+		if err := r.Close(); err != nil {
+			log.Error().Err(err).Msg("Closing database failed")
+		}
+	}
+}
+
+// acquire returns the current reader, which must be released once done with it
+func (m *maxmind) acquire() *sharedReader {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	atomic.AddInt32(&m.db.refs, 1)
+	return m.db
+}
+
+// networkRecord is the network of the record matching an IP, and whether there is a record
+type networkRecord struct {
+	Network string `json:"network"`
+	Found   bool   `json:"found"`
+}
+
+// match returns the network of the record matching ip (ex: "81.2.69.0/24") and, with --not-found=found, whether there
+// is a record. IPs without a record are an error with --not-found=404.
+func (m *maxmind) match(ctx context.Context, ip net.IP) (string, *bool, error) {
+	record, err := m.record(ctx, "network", ip, func(db *sharedReader) (interface{}, error) {
+		var record struct{}
+		network, found, err := db.MMDB.LookupNetwork(ip, &record)
+		if err != nil {
+			return nil, err
+		}
+		return &networkRecord{Network: network.String(), Found: found}, nil
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return "", nil, err
+	}
+	match := record.(*networkRecord)
+
+	switch m.notFound {
+	case NOT_FOUND_ERROR:
+		if !match.Found {
+			return "", nil, lookupStatusError{status: http.StatusNotFound, code: ERR_IP_NOT_FOUND, message: "IP address not found"}
+		}
+	case NOT_FOUND_FIELD:
+		found := match.Found
+		return match.Network, &found, nil
+	}
+	return match.Network, nil, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/rs/zerolog/log"
+)
+
+// recoveryMiddleware answers the requests whose handler panicked with a 500 problem document, instead of net/http
+// closing the connection (and the other requests of a keep-alive or HTTP/2 one). The routers also recover with
+// handlePanic, this covers the handlers around them.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				handlePanic(w, r, recovered)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlePanic logs a recovered handler panic with its stack trace and responds 500. http.ErrAbortHandler, used to
+// abort a response on purpose, is panicked again for net/http to close the connection silently.
+func handlePanic(w http.ResponseWriter, r *http.Request, recovered interface{}) {
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+	httpPanicsTotal.Inc()
+	log.Error().
+		Str("stack", string(debug.Stack())).
+		Msg(fmt.Sprintf("Handler panic on %s '%s': %v", r.Method, r.URL.Path, recovered))
+	errResponse(w, http.StatusInternalServerError, ERR_INTERNAL, "")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// REDIS_TIMEOUT bounds each read and write of the Redis cache, a slow Redis then only costs the lookups a decoding
+const REDIS_TIMEOUT time.Duration = 100 * time.Millisecond
+
+// redisCache shares the decoded records between replicas. Keys contain the MD5 of the database they were decoded
+// from, so an update busts the cache and the records of the previous database expire with their TTL.
+type redisCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// recordTypes returns an empty record of each kind, to decode the records stored in Redis into
+var recordTypes = map[string]func() interface{}{
+	"city":       func() interface{} { return &geoip2.City{} },
+	"country":    func() interface{} { return &geoip2.Country{} },
+	"asn":        func() interface{} { return &geoip2.ASN{} },
+	"anonymous":  func() interface{} { return &geoip2.AnonymousIP{} },
+	"isp":        func() interface{} { return &geoip2.ISP{} },
+	"enterprise": func() interface{} { return &geoip2.Enterprise{} },
+	"domain":     func() interface{} { return &geoip2.Domain{} },
+	"network":    func() interface{} { return &networkRecord{} },
+	"webservice": func() interface{} { return &webServiceRecord{} },
+}
+
+func newRedisCache(url string, ttl time.Duration) (*redisCache, error) {
+	if url == "" {
+		return nil, nil
+	}
+
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	// The commands give up at the deadline of their context (REDIS_TIMEOUT), not after the default 3s read timeout
+	options.ContextTimeoutEnabled = true
+	return &redisCache{client: redis.NewClient(options), ttl: ttl}, nil
+}
+
+func redisKey(edition string, version string, key string) string {
+	return "geoip:" + edition + ":" + version + ":" + key
+}
+
+// get returns the record stored for key, nil when missing, on errors or after REDIS_TIMEOUT (the record then gets
+// decoded from the database)
+func (c *redisCache) get(ctx context.Context, edition string, version string, kind string, key string) interface{} {
+	ctx, cancel := context.WithTimeout(ctx, REDIS_TIMEOUT)
+	defer cancel()
+	data, err := c.client.Get(ctx, redisKey(edition, version, key)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Error().Err(err).Msg("Redis cache read failed")
+		}
+		return nil
+	}
+
+	record := recordTypes[kind]()
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, record); err != nil {
+		log.Error().Err(err).Msg("Redis cache record is invalid")
+		return nil
+	}
+	return record
+}
+
+func (c *redisCache) set(ctx context.Context, edition string, version string, key string, record interface{}) {
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(record)
+	if err != nil {
+		log.Error().Err(err).Msg("Redis cache record encoding failed")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, REDIS_TIMEOUT)
+	defer cancel()
+	if err := c.client.Set(ctx, redisKey(edition, version, key), data, c.ttl).Err(); err != nil {
+		log.Error().Err(err).Msg("Redis cache write failed")
+	}
+}
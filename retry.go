@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"geoip-server/pkg/geoip"
+	"github.com/rs/zerolog/log"
+)
+
+// retryPolicy is how the failed database update fetches are retried, before waiting for the next update interval
+type retryPolicy struct {
+	attempts int
+	delay    time.Duration
+	maxDelay time.Duration
+}
+
+// updateRetry is set from the --update-retry flags, a single attempt otherwise
+var updateRetry = retryPolicy{attempts: 1}
+
+// backoff is the delay after the failed attempt (from 1): the delay doubled at every attempt up to maxDelay, of which
+// a random half is jitter, so the replicas don't all retry at once
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.delay
+	for i := 1; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if p.maxDelay > 0 && delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryable reports whether a fetch error may be transient: network errors and the 429 and 5xx responses of Maxmind,
+// not an invalid license or edition
+func retryable(err error) bool {
+	var statusErr *geoip.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return !errors.Is(err, geoip.ErrNotModified) && !errors.Is(err, context.Canceled)
+}
+
+// fetchWithRetries fetches the database, retrying the transient download failures with updateRetry
+func (m *maxmind) fetchWithRetries(ctx context.Context, accountId string, license string) (*fetchedDatabase, error) {
+	for attempt := 1; ; attempt++ {
+		db, err := m.fetch(ctx, accountId, license)
+		if err == nil || m.path != "" || attempt >= updateRetry.attempts || !retryable(err) {
+			return db, err
+		}
+
+		delay := updateRetry.backoff(attempt)
+		log.Warn().Err(err).Msg(fmt.Sprintf(
+			"Fetching update failed, retrying in %s (edition: '%s', attempt %d of %d)",
+			delay.Round(time.Millisecond), m.edition, attempt, updateRetry.attempts,
+		))
+		m.recordAttemptResult("retried")
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
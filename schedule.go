@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// updateSchedule is when the databases are checked for updates: every interval, or at the times of a cron
+// expression. Neither disables the automatic updates (SIGHUP, /admin/reload and --watch-db still update them).
+type updateSchedule struct {
+	interval time.Duration
+	cron     cron.Schedule
+
+	mutex sync.Mutex
+	// Time of the check wait is sleeping until
+	nextCheck time.Time
+}
+
+// newUpdateSchedule parses the cron expression (5 fields, optionally prefixed with CRON_TZ=<timezone>, or a
+// descriptor like @daily) taking precedence over the interval in hours, 0 disabling the updates.
+func newUpdateSchedule(intervalHours int, expression string) (*updateSchedule, error) {
+	if intervalHours < 0 {
+		return nil, fmt.Errorf("invalid update interval %d, expected hours or 0 to disable the updates", intervalHours)
+	}
+	schedule := &updateSchedule{interval: time.Duration(intervalHours) * time.Hour}
+	if expression != "" {
+		parsed, err := cron.ParseStandard(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid update schedule '%s': %w", expression, err)
+		}
+		schedule.cron = parsed
+	}
+	return schedule, nil
+}
+
+// enabled reports whether the databases are updated automatically
+func (s *updateSchedule) enabled() bool {
+	return s.cron != nil || s.interval > 0
+}
+
+// next returns the time of the update check following t
+func (s *updateSchedule) next(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(t)
+	}
+	return t.Add(s.interval)
+}
+
+// period is the time between two update checks, from now for a cron expression (ex: a week for "0 5 * * 2"),
+// and 0 when disabled.
+func (s *updateSchedule) period() time.Duration {
+	if !s.enabled() {
+		return 0
+	}
+	first := s.next(time.Now())
+	return s.next(first).Sub(first)
+}
+
+// maxAge is the age up to which a persisted database is reused at startup: any when the updates are disabled.
+func (s *updateSchedule) maxAge() time.Duration {
+	if !s.enabled() {
+		return math.MaxInt64
+	}
+	return s.period()
+}
+
+// wait sleeps until the next update check, returning false right away when the updates are disabled.
+func (s *updateSchedule) wait() bool {
+	if !s.enabled() {
+		return false
+	}
+	time.Sleep(time.Until(s.scheduleNext(time.Now())))
+	return true
+}
+
+// scheduleNext records the update check following now as the upcoming one, returning it
+func (s *updateSchedule) scheduleNext(now time.Time) time.Time {
+	next := s.next(now)
+	if s.cron != nil {
+		log.Debug().Msg(fmt.Sprintf("Next database update check at %s", next.Format(time.RFC3339)))
+	}
+	s.mutex.Lock()
+	s.nextCheck = next
+	s.mutex.Unlock()
+	return next
+}
+
+// upcoming returns the time of the next scheduled update check, zero when disabled or not yet scheduled
+func (s *updateSchedule) upcoming() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.nextCheck
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+func TestNewUpdateSchedule(t *testing.T) {
+	for _, expression := range []string{
+		"* * * *",
+		"0 0 5 * * *",
+		"61 * * * *",
+		"0 5 * * mon-",
+		"CRON_TZ=Nowhere/Else 0 5 * * *",
+		"@fortnightly",
+		"every day",
+	} {
+		if _, err := newUpdateSchedule(24, expression); err == nil {
+			t.Errorf("%s: expected an error", expression)
+		}
+	}
+	if _, err := newUpdateSchedule(-1, ""); err == nil {
+		t.Error("expected an error for a negative interval")
+	}
+
+	disabled, err := newUpdateSchedule(0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled.enabled() || disabled.period() != 0 || disabled.wait() {
+		t.Error("expected the updates to be disabled with a 0 interval")
+	}
+}
+
+func TestUpdateScheduleNext(t *testing.T) {
+	now := time.Date(2024, time.January, 2, 10, 30, 0, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no timezone database: ", err)
+	}
+	tests := []struct {
+		interval   int
+		expression string
+		next       time.Time
+		period     time.Duration
+	}{
+		{24, "", now.Add(24 * time.Hour), 24 * time.Hour},
+		// The expression takes precedence over the interval
+		{24, "0 5 * * *", time.Date(2024, time.January, 3, 5, 0, 0, 0, time.UTC), 24 * time.Hour},
+		{0, "0 12 * * *", time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC), 24 * time.Hour},
+		{0, "0 5 * * 2", time.Date(2024, time.January, 9, 5, 0, 0, 0, time.UTC), 7 * 24 * time.Hour},
+		{0, "@hourly", time.Date(2024, time.January, 2, 11, 0, 0, 0, time.UTC), time.Hour},
+		// 10:30 UTC is 5:30 in New York, the period is not checked as it changes with the daylight saving time
+		{0, "CRON_TZ=America/New_York 0 5 * * *", time.Date(2024, time.January, 3, 5, 0, 0, 0, newYork), 0},
+	}
+	for _, test := range tests {
+		schedule, err := newUpdateSchedule(test.interval, test.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !schedule.enabled() {
+			t.Errorf("%d %s: expected the updates to be enabled", test.interval, test.expression)
+		}
+		if next := schedule.next(now); !next.Equal(test.next) {
+			t.Errorf("%d %s: got the next check at %s, expected %s", test.interval, test.expression, next, test.next)
+		}
+		if period := schedule.period(); test.period != 0 && period != test.period {
+			t.Errorf("%d %s: got a period of %s, expected %s", test.interval, test.expression, period, test.period)
+		}
+	}
+}
+
+// TestUpdateStatusNextCheck checks that /admin/update-status reports the scheduled update check
+func TestUpdateStatusNextCheck(t *testing.T) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	databases := []*maxmind{testCityDatabase(t, NOT_FOUND_EMPTY)}
+	schedule, err := newUpdateSchedule(0, "0 5 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle := updateStatusHandler(databases, schedule)
+
+	recorder := httptest.NewRecorder()
+	handle(recorder, httptest.NewRequest(http.MethodGet, "/admin/update-status", nil), nil)
+	var status updateStatusStruct
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.NextUpdateCheck != nil {
+		t.Errorf("got the next check at %s, expected none before it is scheduled", status.NextUpdateCheck)
+	}
+
+	next := schedule.scheduleNext(time.Date(2024, time.January, 2, 10, 30, 0, 0, time.UTC))
+	recorder = httptest.NewRecorder()
+	handle(recorder, httptest.NewRequest(http.MethodGet, "/admin/update-status?edition=GeoIP2-City", nil), nil)
+	status = updateStatusStruct{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2024, time.January, 3, 5, 0, 0, 0, time.UTC)
+	if !next.Equal(expected) || status.NextUpdateCheck == nil || !status.NextUpdateCheck.Equal(expected) {
+		t.Errorf("got the next check at %v, expected %s", status.NextUpdateCheck, expected)
+	}
+	if len(status.Databases) != 1 || status.Databases[0].Edition != "GeoIP2-City" {
+		t.Errorf("got the databases %+v, expected GeoIP2-City", status.Databases)
+	}
+}
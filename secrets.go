@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	SECRETS_SOURCE_VAULT string = "vault://"
+	SECRETS_SOURCE_AWS   string = "aws-sm://"
+	SECRETS_SOURCE_GCP   string = "gcp-sm://"
+)
+
+// SECRETS_TIMEOUT bounds a fetch of the credentials from the secret manager
+const SECRETS_TIMEOUT time.Duration = 30 * time.Second
+
+// The fields of the secrets holding the credentials, like the AccountID and LicenseKey of GeoIP.conf
+const (
+	SECRET_ACCOUNT_ID_KEY string = "account_id"
+	SECRET_LICENSE_KEY    string = "license_key"
+)
+
+// secretSource fetches the fields of a secret from a secret manager
+type secretSource func(ctx context.Context) (map[string]string, error)
+
+// maxmindCredentials are the Maxmind account ID and license, given as flags or fetched from a secret manager and refreshed
+// to follow their rotation
+type maxmindCredentials struct {
+	mutex     sync.RWMutex
+	accountId string
+	license   string
+	source    secretSource
+}
+
+// newMaxmindCredentials returns the credentials of the flags or, when source is set (ex: "vault://secret/maxmind"), the ones
+// fetched from there, the account ID of the flags being kept when the secret has none
+func newMaxmindCredentials(accountId string, license string, source string) (*maxmindCredentials, error) {
+	creds := &maxmindCredentials{accountId: accountId, license: license}
+	if source == "" {
+		return creds, nil
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(source, SECRETS_SOURCE_VAULT):
+		creds.source, err = vaultSecret(strings.TrimPrefix(source, SECRETS_SOURCE_VAULT))
+	case strings.HasPrefix(source, SECRETS_SOURCE_AWS):
+		creds.source = awsSecret(strings.TrimPrefix(source, SECRETS_SOURCE_AWS))
+	case strings.HasPrefix(source, SECRETS_SOURCE_GCP):
+		creds.source = gcpSecret(strings.TrimPrefix(source, SECRETS_SOURCE_GCP))
+	default:
+		err = fmt.Errorf("invalid secrets source '%s', expected %s, %s or %s", source, SECRETS_SOURCE_VAULT, SECRETS_SOURCE_AWS, SECRETS_SOURCE_GCP)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := creds.refresh(); err != nil {
+		return nil, fmt.Errorf("fetching the credentials from '%s': %w", source, err)
+	}
+	return creds, nil
+}
+
+// get returns the account ID and the license
+func (c *maxmindCredentials) get() (string, string) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.accountId, c.license
+}
+
+// refresh fetches the credentials from the secret manager, keeping the current ones on failure
+func (c *maxmindCredentials) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), SECRETS_TIMEOUT)
+	defer cancel()
+	fields, err := c.source(ctx)
+	if err != nil {
+		return err
+	}
+	license := fields[SECRET_LICENSE_KEY]
+	if license == "" {
+		return fmt.Errorf("the secret has no '%s' field", SECRET_LICENSE_KEY)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.license != "" && c.license != license {
+		log.Info().Msg("Maxmind license rotated, using the new one")
+	}
+	c.license = license
+	if accountId := fields[SECRET_ACCOUNT_ID_KEY]; accountId != "" {
+		c.accountId = accountId
+	}
+	return nil
+}
+
+// refreshEvery refreshes the credentials every interval, when fetched from a secret manager
+func (c *maxmindCredentials) refreshEvery(interval time.Duration) {
+	if c.source == nil || interval <= 0 {
+		return
+	}
+	for {
+		time.Sleep(interval)
+		if err := c.refresh(); err != nil {
+			log.Error().Err(err).Msg("Refreshing the Maxmind credentials failed, keeping the current ones")
+		}
+	}
+}
+
+// secretFields decodes a secret value: a JSON object, or else the license alone
+func secretFields(value []byte) map[string]string {
+	var object map[string]interface{}
+	if err := decodeSecret(value, &object); err != nil || object == nil {
+		return map[string]string{SECRET_LICENSE_KEY: strings.TrimSpace(string(value))}
+	}
+	return stringFields(object)
+}
+
+// decodeSecret decodes JSON, keeping the numbers (ex: an account ID) as written
+func decodeSecret(data []byte, v interface{}) error {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func stringFields(object map[string]interface{}) map[string]string {
+	fields := map[string]string{}
+	for key, value := range object {
+		fields[key] = fmt.Sprint(value)
+	}
+	return fields
+}
+
+// vaultSecret reads a secret of a Vault KV version 2 engine, "<mount>/<path>" (ex: "secret/maxmind"), at VAULT_ADDR
+// with the token of VAULT_TOKEN or ~/.vault-token (ex: written by the Vault agent), in VAULT_NAMESPACE if set
+func vaultSecret(secret string) (secretSource, error) {
+	mount, path, ok := strings.Cut(secret, "/")
+	if !ok || mount == "" || path == "" {
+		return nil, fmt.Errorf("invalid Vault secret '%s', expected <mount>/<path>", secret)
+	}
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		address = "https://127.0.0.1:8200"
+	}
+	endpoint := strings.TrimSuffix(address, "/") + "/v1/" + url.PathEscape(mount) + "/data/" + path
+
+	return func(ctx context.Context) (map[string]string, error) {
+		// Read at every fetch, as the agent renews it
+		token := os.Getenv("VAULT_TOKEN")
+		if token == "" {
+			home, _ := os.UserHomeDir()
+			content, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+			if err != nil {
+				return nil, fmt.Errorf("no VAULT_TOKEN nor ~/.vault-token: %w", err)
+			}
+			token = strings.TrimSpace(string(content))
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Vault-Token", token)
+		if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+			req.Header.Set("X-Vault-Namespace", namespace)
+		}
+		body, err := secretRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+		if err := decodeSecret(body, &resp); err != nil {
+			return nil, err
+		}
+		return stringFields(resp.Data.Data), nil
+	}, nil
+}
+
+// awsSecret reads a secret of AWS Secrets Manager by name or ARN, with the default credentials chain (environment,
+// shared config, IAM role for service accounts, instance role). The region is the one of the ARN, or else of the
+// environment.
+func awsSecret(secretId string) secretSource {
+	return func(ctx context.Context) (map[string]string, error) {
+		var options []func(*awsconfig.LoadOptions) error
+		if arn := strings.Split(secretId, ":"); len(arn) > 3 && arn[0] == "arn" {
+			options = append(options, awsconfig.WithRegion(arn[3]))
+		}
+		config, err := awsconfig.LoadDefaultConfig(ctx, options...)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := secretsmanager.NewFromConfig(config).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(secretId),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.SecretString != nil {
+			return secretFields([]byte(*resp.SecretString)), nil
+		}
+		return secretFields(resp.SecretBinary), nil
+	}
+}
+
+// gcpSecret reads the latest version of a secret of GCP Secret Manager, "projects/<project>/secrets/<secret>" (or
+// a ".../versions/<version>"), with the application default credentials (ex: of the workload identity)
+func gcpSecret(name string) secretSource {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	endpoint := "https://secretmanager.googleapis.com/v1/" + name + ":access"
+
+	return func(ctx context.Context) (map[string]string, error) {
+		tokens, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+		if err != nil {
+			return nil, err
+		}
+		token, err := tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		token.SetAuthHeader(req)
+		body, err := secretRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var json = jsoniter.ConfigCompatibleWithStandardLibrary
+		var resp struct {
+			Payload struct {
+				Data string `json:"data"`
+			} `json:"payload"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		value, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+		if err != nil {
+			return nil, err
+		}
+		return secretFields(value), nil
+	}
+}
+
+// secretRequest sends a request to a secret manager API, returning the body of its successful response
+func secretRequest(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status %d", req.URL.Host, resp.StatusCode)
+	}
+	return body, nil
+}
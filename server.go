@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+	"golang.org/x/net/netutil"
+)
+
+// serverOptions are the timeouts and limits of the HTTP servers, protecting them from the slow or too many clients
+type serverOptions struct {
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	maxConnections    int
+}
+
+func addServerFlags(flags *pflag.FlagSet) *serverOptions {
+	options := &serverOptions{}
+	flags.DurationVar(&options.readTimeout, "read-timeout", 30*time.Second, "Timeout to read a request, including its body, disabled when 0")
+	flags.DurationVar(&options.readHeaderTimeout, "read-header-timeout", 5*time.Second, "Timeout to read the headers of a request (slow-loris protection), disabled when 0")
+	flags.DurationVar(&options.writeTimeout, "write-timeout", 60*time.Second, "Timeout to write a response, from the end of its headers, disabled when 0. The pprof profiles and traces must be shorter.")
+	flags.DurationVar(&options.idleTimeout, "idle-timeout", 120*time.Second, "Time to keep an idle keep-alive connection open, --read-timeout when 0")
+	flags.IntVar(&options.maxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "Maximum size in bytes of the headers of a request")
+	flags.IntVar(&options.maxConnections, "max-connections", 0, "Maximum number of concurrent connections per listener, the next ones waiting to be accepted, disabled when 0")
+	return options
+}
+
+// apply sets the timeouts of a server
+func (o *serverOptions) apply(server *http.Server) {
+	server.ReadTimeout = o.readTimeout
+	server.ReadHeaderTimeout = o.readHeaderTimeout
+	server.WriteTimeout = o.writeTimeout
+	server.IdleTimeout = o.idleTimeout
+	server.MaxHeaderBytes = o.maxHeaderBytes
+}
+
+// bindAddress is an address to listen on, with its network
+type bindAddress struct {
+	network string
+	address string
+}
+
+// listen returns the listeners given (ex: passed by systemd), or else new ones on the addresses, limited to
+// --max-connections each
+func (o *serverOptions) listen(listeners []net.Listener, addresses []bindAddress) ([]net.Listener, error) {
+	if listeners == nil {
+		for _, address := range addresses {
+			listener, err := net.Listen(address.network, address.address)
+			if err != nil {
+				return nil, err
+			}
+			log.Info().Msg(fmt.Sprintf("Listening on '%s'", listener.Addr()))
+			listeners = append(listeners, listener)
+		}
+	}
+	if o.maxConnections > 0 {
+		for i, listener := range listeners {
+			listeners[i] = netutil.LimitListener(listener, o.maxConnections)
+		}
+	}
+	return listeners, nil
+}
+
+// parseBinds returns the --bind addresses, on tcp4 or tcp6 for an IP (ex: [::]:8080 only accepting IPv6, to be
+// listened on next to 0.0.0.0:8080), otherwise on tcp, dual-stack (ex: :8080)
+func parseBinds(binds []string) []bindAddress {
+	addresses := make([]bindAddress, len(binds))
+	for i, bind := range binds {
+		addresses[i] = bindAddress{network: "tcp", address: bind}
+		host, _, err := net.SplitHostPort(bind)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+			addresses[i].network = "tcp4"
+		} else if ip != nil {
+			addresses[i].network = "tcp6"
+		}
+	}
+	return addresses
+}
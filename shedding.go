@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// SHED_RETRY_AFTER is the Retry-After of the requests shed, in seconds
+const SHED_RETRY_AFTER int = 1
+
+// loadShedder bounds the lookups served concurrently, the next ones waiting in a queue for up to a deadline. The
+// requests that can't be queued, or wait past the deadline, are answered 503 right away rather than slowing down all
+// the others.
+type loadShedder struct {
+	slots        chan struct{}
+	maxQueued    int64
+	queueTimeout time.Duration
+	queued       atomic.Int64
+}
+
+// newLoadShedder returns a shedder serving maxConcurrent requests at once, with at most maxQueued waiting (unbounded
+// when 0) for up to queueTimeout (shed right away when 0). It is nil, shedding nothing, when maxConcurrent is 0.
+func newLoadShedder(maxConcurrent int, maxQueued int, queueTimeout time.Duration) *loadShedder {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return &loadShedder{
+		slots:        make(chan struct{}, maxConcurrent),
+		maxQueued:    int64(maxQueued),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// middleware serves the requests of a route once they got a slot
+func (s *loadShedder) middleware(route string, next httprouter.Handle) httprouter.Handle {
+	if s == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			if reason := s.wait(r); reason != "" {
+				if reason != "canceled" {
+					w.Header().Set("Retry-After", strconv.Itoa(SHED_RETRY_AFTER))
+					errResponse(w, http.StatusServiceUnavailable, ERR_OVERLOADED, "Server overloaded, retry later")
+				}
+				requestsShedTotal.WithLabelValues(route, reason).Inc()
+				statsd.count("http.requests_shed", "route:"+route, "reason:"+reason)
+				return
+			}
+		}
+		requestsInFlight.Inc()
+		defer func() {
+			requestsInFlight.Dec()
+			<-s.slots
+		}()
+		next(w, r, ps)
+	}
+}
+
+// wait queues a request until it gets a slot, returning why it was shed otherwise: queue_full, queue_timeout or
+// canceled (by the client)
+func (s *loadShedder) wait(r *http.Request) string {
+	if s.queueTimeout <= 0 {
+		return "queue_full"
+	}
+	queued := s.queued.Add(1)
+	defer s.queued.Add(-1)
+	if s.maxQueued > 0 && queued > s.maxQueued {
+		return "queue_full"
+	}
+	requestsQueued.Inc()
+	defer requestsQueued.Dec()
+
+	timer := time.NewTimer(s.queueTimeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return ""
+	case <-timer.C:
+		return "queue_timeout"
+	case <-r.Context().Done():
+		return "canceled"
+	}
+}
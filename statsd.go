@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// statsd pushes the request and update metrics to StatsD when --statsd-address is set, nil otherwise
+var statsd *statsdClient
+
+// statsdClient sends metrics over UDP, with the tags in the DogStatsD format (ex: "geoip.http.requests:1|c|#code:200")
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+func newStatsdClient(address string, prefix string, tags []string) (*statsdClient, error) {
+	if address == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdClient{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// send writes a metric of the type ("c", "g" or "ms"), the value is already formatted
+func (c *statsdClient) send(name string, value string, metricType string, tags []string) {
+	if c == nil {
+		return
+	}
+	metric := c.prefix + name + ":" + value + "|" + metricType
+	if allTags := append(append([]string{}, c.tags...), tags...); len(allTags) > 0 {
+		metric += "|#" + strings.Join(allTags, ",")
+	}
+	// Metrics are best effort, a missing agent must not slow down the requests
+	if _, err := c.conn.Write([]byte(metric)); err != nil {
+		log.Debug().Err(err).Msg("Sending StatsD metric failed")
+	}
+}
+
+func (c *statsdClient) count(name string, tags ...string) {
+	c.send(name, "1", "c", tags)
+}
+
+func (c *statsdClient) gauge(name string, value float64, tags ...string) {
+	c.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+func (c *statsdClient) timing(name string, duration time.Duration, tags ...string) {
+	c.send(name, strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', 3, 64), "ms", tags)
+}
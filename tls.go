@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// loadTLSConfig returns the TLS configuration serving the certificate, nil when none is configured
+func loadTLSConfig(certFile string, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both --tls-cert and --tls-key are required for TLS")
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return hardenTLSConfig(&tls.Config{Certificates: []tls.Certificate{certificate}}), nil
+}
+
+// acmeCertManager obtains and renews the certificates of the domains from Let's Encrypt, caching them in cacheDir
+func acmeCertManager(domains []string, cacheDir string, email string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      email,
+	}
+}
+
+// hardenTLSConfig sets TLS 1.2 as the minimum, restricted to forward secret AEAD ciphers
+// (TLS 1.3 ones are not configurable)
+func hardenTLSConfig(config *tls.Config) *tls.Config {
+	config.MinVersion = tls.VersionTLS12
+	config.CipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	}
+	return config
+}
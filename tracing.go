@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"geoip-server/pkg/geoip"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans, they are only recorded once setupTracing set the global provider
+var tracer = otel.Tracer("geoip-server")
+
+// setupTracing exports the spans with OTLP over HTTP when an endpoint is configured by the standard environment
+// variables (OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, with OTEL_EXPORTER_OTLP_HEADERS,
+// OTEL_SERVICE_NAME...). The returned function flushes the spans, call it before exiting.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return noop, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName("geoip-server"), semconv.ServiceVersion(buildVersion())),
+		resource.Environment(),
+	)
+	if err != nil {
+		return noop, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	// The lookups are children of the span of the calling service, from the traceparent header
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// startSpan starts a span of a database operation
+func startSpan(ctx context.Context, name string, edition string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String("geoip.edition", edition)))
+}
+
+// endSpan ends the span, failed when err is set. An unmodified database is not a failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, geoip.ErrNotModified) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endUpdateSpan ends the span of a database update with its result (updated, not_modified or failed), an unmodified
+// database being a successful update
+func endUpdateSpan(span trace.Span, result string, err error) {
+	span.SetAttributes(attribute.String("geoip.update.result", result))
+	if result == "not_modified" {
+		err = nil
+	}
+	endSpan(span, err)
+}
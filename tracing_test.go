@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"geoip-server/pkg/geoip"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestEndUpdateSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tests := []struct {
+		result string
+		err    error
+		status codes.Code
+	}{
+		{"updated", nil, codes.Unset},
+		{"not_modified", geoip.ErrNotModified, codes.Unset},
+		{"not_modified", fmt.Errorf("reading the cached database: %w", geoip.ErrNotModified), codes.Unset},
+		{"failed", errors.New("download failed with status 401"), codes.Error},
+	}
+	for _, test := range tests {
+		_, span := provider.Tracer("test").Start(context.Background(), "database update")
+		endUpdateSpan(span, test.result, test.err)
+
+		spans := recorder.Ended()
+		ended := spans[len(spans)-1]
+		if ended.Status().Code != test.status {
+			t.Errorf("%s %v: got the status %s, expected %s", test.result, test.err, ended.Status().Code, test.status)
+		}
+		if test.status == codes.Unset && len(ended.Events()) > 0 {
+			t.Errorf("%s %v: expected no error recorded, got %v", test.result, test.err, ended.Events())
+		}
+		if !containsAttribute(ended, attribute.String("geoip.update.result", test.result)) {
+			t.Errorf("%s %v: expected the result in %v", test.result, test.err, ended.Attributes())
+		}
+	}
+}
+
+func containsAttribute(span sdktrace.ReadOnlySpan, expected attribute.KeyValue) bool {
+	for _, attribute := range span.Attributes() {
+		if attribute == expected {
+			return true
+		}
+	}
+	return false
+}
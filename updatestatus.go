@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// UPDATE_HISTORY_SIZE is the number of update attempts kept per database for /admin/update-status
+const UPDATE_HISTORY_SIZE int = 10
+
+type updateStatusStruct struct {
+	// Unset when the automatic updates are disabled
+	NextUpdateCheck *time.Time                   `json:"next_update_check,omitempty"`
+	Databases       []databaseUpdateStatusStruct `json:"databases"`
+}
+
+type databaseUpdateStatusStruct struct {
+	databaseReadinessStruct
+	// Newest first
+	Attempts []updateAttemptStruct `json:"attempts"`
+}
+
+type updateAttemptStruct struct {
+	Time time.Time `json:"time"`
+	// Including the retries
+	DurationSeconds float64 `json:"duration_seconds"`
+	// loaded (at startup), updated, not_modified or failed
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// recordAttempt keeps the outcome of an update attempt started at start, reported by /readyz and
+// /admin/update-status
+func (m *maxmind) recordAttempt(start time.Time, result string, err error) {
+	duration := time.Since(start)
+	attempt := updateAttemptStruct{Time: start.UTC(), DurationSeconds: duration.Seconds(), Result: result}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	m.mutex.Lock()
+	m.lastAttempt = time.Now()
+	m.lastAttemptErr = err
+	if err == nil {
+		m.lastSuccess = m.lastAttempt
+	}
+	m.history = append([]updateAttemptStruct{attempt}, m.history...)
+	if len(m.history) > UPDATE_HISTORY_SIZE {
+		m.history = m.history[:UPDATE_HISTORY_SIZE]
+	}
+	m.mutex.Unlock()
+
+	databaseUpdateDuration.WithLabelValues(m.edition, result).Observe(duration.Seconds())
+	databaseLastUpdateAttempt.WithLabelValues(m.edition).SetToCurrentTime()
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	databaseLastUpdateFailed.WithLabelValues(m.edition).Set(failed)
+	statsd.timing("database.update_duration", duration, "edition:"+m.edition, "result:"+result)
+}
+
+func (m *maxmind) updateStatus() databaseUpdateStatusStruct {
+	status := databaseUpdateStatusStruct{databaseReadinessStruct: m.readiness()}
+	m.mutex.RLock()
+	status.Attempts = append([]updateAttemptStruct{}, m.history...)
+	m.mutex.RUnlock()
+	return status
+}
+
+// updateStatusHandler responds with the last update attempts of the databases, or only the one named by the
+// "edition" query parameter, and the time of the next scheduled check
+func updateStatusHandler(databases []*maxmind, schedule *updateSchedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		edition := r.URL.Query().Get("edition")
+		resp := updateStatusStruct{Databases: []databaseUpdateStatusStruct{}}
+		for _, m := range databases {
+			if edition != "" && m.edition != edition {
+				continue
+			}
+			resp.Databases = append(resp.Databases, m.updateStatus())
+		}
+
+		if len(resp.Databases) == 0 {
+			errResponse(w, http.StatusNotFound, ERR_EDITION_NOT_LOADED, "Edition not loaded")
+			return
+		}
+		if next := schedule.upcoming(); !next.IsZero() {
+			resp.NextUpdateCheck = &next
+		}
+		geoResponse(w, resp)
+	}
+}
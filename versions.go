@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"geoip-server/pkg/geoip"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/rs/zerolog/log"
+)
+
+// databaseVersionStruct is a previous database kept in the data directory, see --keep-versions
+type databaseVersionStruct struct {
+	BuildTime  time.Time `json:"build_time"`
+	BuildEpoch uint      `json:"build_epoch"`
+	MD5        string    `json:"md5"`
+	path       string
+}
+
+// versionPath is where the database of a build is kept, ex: GeoLite2-City.1704153600.mmdb
+func (m *maxmind) versionPath(buildEpoch uint) string {
+	return filepath.Join(m.dataDir, fmt.Sprintf("%s.%d.mmdb", m.edition, buildEpoch))
+}
+
+// skipPath holds the MD5s of the databases rolled back from, one per line, not to download them again
+func (m *maxmind) skipPath() string {
+	return filepath.Join(m.dataDir, m.edition+".rolled-back")
+}
+
+// skipped reports whether the database of the MD5 was rolled back from
+func (m *maxmind) skipped(sum string) bool {
+	data, err := ioutil.ReadFile(m.skipPath())
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == sum {
+			return true
+		}
+	}
+	return false
+}
+
+// versions returns the kept databases, the most recent build first
+func (m *maxmind) versions() ([]databaseVersionStruct, error) {
+	if m.dataDir == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(m.dataDir, m.edition+".*.mmdb"))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []databaseVersionStruct{}
+	for _, path := range paths {
+		epoch := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), m.edition+"."), ".mmdb")
+		buildEpoch, err := strconv.ParseUint(epoch, 10, 64)
+		if err != nil {
+			continue
+		}
+		sum, err := versionMD5(path)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, databaseVersionStruct{
+			BuildTime:  time.Unix(int64(buildEpoch), 0).UTC(),
+			BuildEpoch: uint(buildEpoch),
+			MD5:        sum,
+			path:       path,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].BuildEpoch > versions[j].BuildEpoch })
+	return versions, nil
+}
+
+// versionMD5 returns the MD5 of a kept database, recorded when it was kept not to hash it (ex: for every /dbinfo),
+// or hashed and recorded once for the ones kept without
+func versionMD5(path string) (string, error) {
+	data, err := ioutil.ReadFile(path + ".md5")
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	sum, err := geoip.FileMD5(path)
+	if err != nil {
+		return "", err
+	}
+	if err := writeVersionMD5(path, sum); err != nil {
+		log.Error().Err(err).Msg(fmt.Sprintf("Recording the MD5 of '%s' failed", path))
+	}
+	return sum, nil
+}
+
+// writeVersionMD5 records the MD5 of a kept database in "<path>.md5", replaced atomically as the replicas sharing
+// the data directory read it
+func writeVersionMD5(path string, sum string) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".md5.*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temp.WriteString(sum + "\n")
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path+".md5")
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// buildEpoch is the build time of a database file, in seconds since the epoch
+func buildEpoch(path string) (uint, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return reader.Metadata.BuildEpoch, nil
+}
+
+// keepVersion keeps the persisted database as a version before it is replaced, removing the oldest versions beyond
+// m.keepVersions
+func (m *maxmind) keepVersion() error {
+	if m.keepVersions <= 0 {
+		return nil
+	}
+	if err := m.archive(); err != nil {
+		return err
+	}
+
+	versions, err := m.versions()
+	if err != nil {
+		return err
+	}
+	for i := m.keepVersions; i < len(versions); i++ {
+		if err := os.Remove(versions[i].path); err != nil {
+			return err
+		}
+		if err := os.Remove(versions[i].path + ".md5"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// archive keeps the persisted database as the version of its build, with its MD5. It is hard linked, so the persisted
+// copy is never missing.
+func (m *maxmind) archive() error {
+	epoch, err := buildEpoch(m.cachePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	path := m.versionPath(epoch)
+	if err := os.Link(m.cachePath(), path); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if _, err := os.Stat(path + ".md5"); err == nil {
+		return nil
+	}
+	sum, err := geoip.FileMD5(path)
+	if err != nil {
+		return err
+	}
+	return writeVersionMD5(path, sum)
+}
+
+// rollback replaces the persisted database with a kept version: the one of the build (epoch), or else the most recent
+// one built before the current one. The database rolled back from is kept as a version, and skipped by the next updates so they don't
+// undo the rollback, until Maxmind releases another one.
+func (m *maxmind) rollback(build uint) (*fetchedDatabase, error) {
+	if m.dataDir == "" {
+		return nil, errors.New("rolling back needs a data directory")
+	}
+	currentMD5, err := geoip.FileMD5(m.cachePath())
+	if err != nil {
+		return nil, err
+	}
+	currentEpoch, err := buildEpoch(m.cachePath())
+	if err != nil {
+		return nil, err
+	}
+	// Kept regardless of --keep-versions, to be able to roll forward
+	if err := m.archive(); err != nil {
+		return nil, err
+	}
+
+	versions, err := m.versions()
+	if err != nil {
+		return nil, err
+	}
+	var target *databaseVersionStruct
+	for i, version := range versions {
+		if build != 0 && version.BuildEpoch == build || build == 0 && version.BuildEpoch < currentEpoch {
+			target = &versions[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("no version to roll back to (edition: '%s')", m.edition)
+	}
+	if target.MD5 == currentMD5 {
+		return nil, fmt.Errorf("the version is already the current one (edition: '%s')", m.edition)
+	}
+
+	// Linked to a temporary file renamed over the persisted copy, which is replaced atomically
+	temp := m.cachePath() + ".rollback.tmp"
+	os.Remove(temp)
+	if err := os.Link(target.path, temp); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(temp, m.cachePath()); err != nil {
+		os.Remove(temp)
+		return nil, err
+	}
+	skip, err := os.OpenFile(m.skipPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_, err = skip.WriteString(currentMD5 + "\n")
+	if closeErr := skip.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msg(fmt.Sprintf("Rolled back to the database built at %s (edition: '%s')", target.BuildTime.Format(time.RFC3339), m.edition))
+	return &fetchedDatabase{path: m.cachePath(), md5: target.MD5}, nil
+}
+
+// rollbackAndReload rolls back the database and swaps it in, in between the updates
+func (m *maxmind) rollbackAndReload(build uint) error {
+	m.updating.Lock()
+	defer m.updating.Unlock()
+
+	db, err := m.rollback(build)
+	if err != nil {
+		return err
+	}
+	oldBuildEpoch := m.buildEpoch()
+	if err := m.reload(db); err != nil {
+		return err
+	}
+	m.recordUpdate()
+	m.notifyChange("rolled_back", oldBuildEpoch)
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// WATCH_DEBOUNCE is the time after the last change of a watched file before reloading it, as replacing a file takes
+// several events
+const WATCH_DEBOUNCE time.Duration = time.Second
+
+// watchDatabases reloads the --watch-db databases whenever their file is replaced, ex: by geoipupdate or a Kubernetes
+// ConfigMap mount. Their directories are watched, as the file itself is renamed over or, for the mounts, a symlink to
+// a "..data" directory that is swapped.
+func watchDatabases(databases []*maxmind) error {
+	watched := map[string][]*maxmind{}
+	for _, m := range databases {
+		if m.watch {
+			dir := filepath.Dir(m.path)
+			watched[dir] = append(watched[dir], m)
+		}
+	}
+	if len(watched) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for dir := range watched {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("watching '%s' failed: %w", dir, err)
+		}
+		log.Info().Msg(fmt.Sprintf("Watching '%s' for database changes", dir))
+	}
+
+	go func() {
+		timers := map[string]*time.Timer{}
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				dir := filepath.Dir(event.Name)
+				if event.Op == fsnotify.Chmod || !watchedChange(event.Name, watched[dir]) {
+					continue
+				}
+				if timer, ok := timers[dir]; ok {
+					timer.Reset(WATCH_DEBOUNCE)
+					continue
+				}
+				changed := watched[dir]
+				timers[dir] = time.AfterFunc(WATCH_DEBOUNCE, func() {
+					for _, m := range changed {
+						log.Info().Msg(fmt.Sprintf("Database file changed, reloading '%s'", m.path))
+						m.update("", "")
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error().Err(err).Msg("Watching the databases failed")
+			}
+		}
+	}()
+	return nil
+}
+
+// watchedChange reports whether the changed file is one of the databases, or the data of a ConfigMap mount
+func watchedChange(name string, databases []*maxmind) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, "..") {
+		return true
+	}
+	for _, m := range databases {
+		if filepath.Base(m.path) == base {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	WEBHOOK_FORMAT_JSON  string = "json"
+	WEBHOOK_FORMAT_SLACK string = "slack"
+)
+
+// WEBHOOK_TIMEOUT bounds the webhook requests, they are sent in the background
+const WEBHOOK_TIMEOUT time.Duration = 10 * time.Second
+
+// webhook notifies of the database changes when --webhook-url is set, nil otherwise
+var webhook *webhookClient
+
+// webhookClient POSTs the database changes to a URL, as JSON or as a Slack message (also read by Mattermost, Teams
+// workflows and Google Chat)
+type webhookClient struct {
+	url    string
+	format string
+	client *http.Client
+}
+
+// databaseChangeStruct is the JSON webhook payload
+type databaseChangeStruct struct {
+	// "updated" or "rolled_back"
+	Event         string    `json:"event"`
+	Edition       string    `json:"edition"`
+	OldBuildEpoch uint      `json:"old_build_epoch"`
+	OldBuildTime  time.Time `json:"old_build_time"`
+	NewBuildEpoch uint      `json:"new_build_epoch"`
+	NewBuildTime  time.Time `json:"new_build_time"`
+	MD5           string    `json:"md5"`
+	Time          time.Time `json:"time"`
+}
+
+func newWebhookClient(url string, format string) (*webhookClient, error) {
+	if url == "" {
+		return nil, nil
+	}
+	if format != WEBHOOK_FORMAT_JSON && format != WEBHOOK_FORMAT_SLACK {
+		return nil, fmt.Errorf("invalid webhook format '%s', expected '%s' or '%s'", format, WEBHOOK_FORMAT_JSON, WEBHOOK_FORMAT_SLACK)
+	}
+	return &webhookClient{url: url, format: format, client: &http.Client{Timeout: WEBHOOK_TIMEOUT}}, nil
+}
+
+// payload is the request body of the change, in the webhook format
+func (c *webhookClient) payload(change databaseChangeStruct) ([]byte, error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	if c.format == WEBHOOK_FORMAT_JSON {
+		return json.Marshal(change)
+	}
+
+	verb := "updated"
+	if change.Event == "rolled_back" {
+		verb = "rolled back"
+	}
+	text := fmt.Sprintf(
+		"GeoIP database *%s* %s: build %s (%d) → %s (%d)",
+		change.Edition, verb,
+		change.OldBuildTime.Format(time.RFC3339), change.OldBuildEpoch,
+		change.NewBuildTime.Format(time.RFC3339), change.NewBuildEpoch,
+	)
+	return json.Marshal(map[string]string{"text": text})
+}
+
+// notify sends the change in the background, failures are only logged as they must not fail the update
+func (c *webhookClient) notify(change databaseChangeStruct) {
+	if c == nil {
+		return
+	}
+	body, err := c.payload(change)
+	if err != nil {
+		log.Error().Err(err).Msg("Encoding the webhook payload failed")
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), WEBHOOK_TIMEOUT)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+		if err != nil {
+			log.Error().Err(err).Msg("Sending the webhook failed")
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.client.Do(req)
+		if err != nil {
+			log.Error().Err(err).Msg(fmt.Sprintf("Sending the webhook failed (edition: '%s')", change.Edition))
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Error().Msg(fmt.Sprintf("Webhook responded with status %d (edition: '%s')", resp.StatusCode, change.Edition))
+		}
+	}()
+}
+
+// buildEpoch is the build epoch of the loaded database, 0 when not loaded
+func (m *maxmind) buildEpoch() uint {
+	return uint(m.loadedBuildEpoch.Load())
+}
+
+// notifyChange sends the webhook of the database loaded in place of the build of oldBuildEpoch
+func (m *maxmind) notifyChange(event string, oldBuildEpoch uint) {
+	newBuildEpoch := m.buildEpoch()
+	m.mutex.RLock()
+	md5 := m.md5
+	m.mutex.RUnlock()
+	webhook.notify(databaseChangeStruct{
+		Event:         event,
+		Edition:       m.edition,
+		OldBuildEpoch: oldBuildEpoch,
+		OldBuildTime:  time.Unix(int64(oldBuildEpoch), 0).UTC(),
+		NewBuildEpoch: newBuildEpoch,
+		NewBuildTime:  time.Unix(int64(newBuildEpoch), 0).UTC(),
+		MD5:           md5,
+		Time:          time.Now().UTC(),
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// The codes of the MaxMind web service errors, which its clients raise specific exceptions for
+const (
+	MAXMIND_IP_ADDRESS_INVALID    string = "IP_ADDRESS_INVALID"
+	MAXMIND_IP_ADDRESS_RESERVED   string = "IP_ADDRESS_RESERVED"
+	MAXMIND_IP_ADDRESS_NOT_FOUND  string = "IP_ADDRESS_NOT_FOUND"
+	MAXMIND_ACCOUNT_ID_REQUIRED   string = "ACCOUNT_ID_REQUIRED"
+	MAXMIND_LICENSE_KEY_REQUIRED  string = "LICENSE_KEY_REQUIRED"
+	MAXMIND_AUTHORIZATION_INVALID string = "AUTHORIZATION_INVALID"
+)
+
+// webServiceRecord is a record as stored in the database, the structure of the MaxMind web service responses
+type webServiceRecord struct {
+	Network string                 `json:"network"`
+	Found   bool                   `json:"found"`
+	Record  map[string]interface{} `json:"record"`
+}
+
+// webServiceFields are the top level fields of the responses of each service, nil for all of them
+var webServiceFields = map[string][]string{
+	"country":  {"continent", "country", "registered_country", "represented_country", "traits"},
+	"city":     nil,
+	"insights": nil,
+}
+
+// webServiceRoutes serves the GeoIP2 Precision web service: /geoip/v2.1/{country,city,insights}/<ip>, the client IP
+// for "me", for the official MaxMind clients to use this server as their host, authenticated with webServiceAuth.
+func webServiceRoutes(router *httprouter.Router, prefix string, c *compatContext) {
+	route := prefix + "/geoip/v2.1/:service/:ip"
+	router.GET(route, webServiceAuth(c.apiKeys, c.apiRoute(route, webServiceHandler(c))))
+}
+
+func webServiceHandler(c *compatContext) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		service := ps.ByName("service")
+		fields, ok := webServiceFields[service]
+		if !ok {
+			errResponse(w, http.StatusNotFound, ERR_NOT_FOUND, "Unknown route")
+			return
+		}
+
+		ipStr := ps.ByName("ip")
+		if ipStr == "me" {
+			ipStr = c.resolver.clientIP(r)
+		}
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			log.Info().Msg(fmt.Sprintf("Invalid IP: '%s'", logIP(ipStr)))
+			errResponse(w, http.StatusBadRequest, MAXMIND_IP_ADDRESS_INVALID, fmt.Sprintf("The value \"%s\" is not a valid IP address.", ipStr))
+			return
+		}
+		if isBogon(ip) {
+			errResponse(w, http.StatusBadRequest, MAXMIND_IP_ADDRESS_RESERVED, fmt.Sprintf("The value \"%s\" belongs to a reserved or private range.", ipStr))
+			return
+		}
+		log.Info().Msg(fmt.Sprintf("Looking up IP '%s'", logIP(ipStr)))
+
+		record, err := c.city.webServiceRecord(r.Context(), ip)
+		if err != nil {
+			status, code, message := lookupError(err)
+			errResponse(w, status, code, message)
+			return
+		}
+		if !record.Found {
+			errResponse(w, http.StatusNotFound, MAXMIND_IP_ADDRESS_NOT_FOUND, fmt.Sprintf("The value \"%s\" is not in the database.", ipStr))
+			return
+		}
+
+		// The cached records are shared, the response is a copy
+		resp := map[string]interface{}{}
+		for field, value := range record.Record {
+			if fields == nil || slices.Contains(fields, field) {
+				resp[field] = value
+			}
+		}
+		// The country service only has the IP in its traits
+		traits := map[string]interface{}{}
+		if recordTraits, ok := record.Record["traits"].(map[string]interface{}); ok && service != "country" {
+			for field, value := range recordTraits {
+				traits[field] = value
+			}
+		}
+		traits["ip_address"] = ipStr
+		traits["network"] = record.Network
+		if c.asn != nil && service != "country" {
+			if asn, err := c.asn(r.Context(), ipStr, ip, nil); err == nil {
+				if asn, ok := asn.(asnResponseStruct); ok && asn.ASN != 0 {
+					traits["autonomous_system_number"] = asn.ASN
+					traits["autonomous_system_organization"] = asn.Organization
+				}
+			}
+		}
+		resp["traits"] = traits
+
+		w.Header().Set("Content-Type", "application/vnd.maxmind.com-"+service+"+json; charset=UTF-8; version=2.1")
+		geoResponse(w, resp)
+	}
+}
+
+// webServiceAuth takes the license key of the basic authentication (the user being the account ID of the MaxMind
+// clients) as the API key, answering with the MaxMind errors the clients raise an AuthenticationError for. The other
+// ways to send the API key are accepted too, without basic authentication.
+func webServiceAuth(keys []string, next httprouter.Handle) httprouter.Handle {
+	if len(keys) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		accountId, license, ok := r.BasicAuth()
+		key := requestAPIKey(r)
+		if !ok && isValidAPIKey(key, keys) {
+			next(w, r, ps)
+			return
+		}
+
+		code, message := "", ""
+		switch {
+		case !ok && key != "":
+			code, message = MAXMIND_AUTHORIZATION_INVALID, "You have supplied an invalid API key."
+		case accountId == "":
+			code, message = MAXMIND_ACCOUNT_ID_REQUIRED, "You have not supplied a MaxMind account ID in the Authorization header."
+		case license == "":
+			code, message = MAXMIND_LICENSE_KEY_REQUIRED, "You have not supplied a MaxMind license key in the Authorization header."
+		case !isValidAPIKey(license, keys):
+			code, message = MAXMIND_AUTHORIZATION_INVALID, "You have supplied an invalid MaxMind account ID and/or license key in the Authorization header."
+		}
+		if code != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="geoip-server"`)
+			errResponse(w, http.StatusUnauthorized, code, message)
+			return
+		}
+		r.Header.Set("X-API-Key", license)
+		next(w, r, ps)
+	}
+}
+
+// webServiceRecord returns the record of ip as stored in the database, with all its names
+func (m *maxmind) webServiceRecord(ctx context.Context, ip net.IP) (*webServiceRecord, error) {
+	record, err := m.record(ctx, "webservice", ip, func(db *sharedReader) (interface{}, error) {
+		record := &webServiceRecord{}
+		network, found, err := db.MMDB.LookupNetwork(ip, &record.Record)
+		if err != nil {
+			return nil, err
+		}
+		record.Network, record.Found = network.String(), found
+		return record, nil
+	})
+	if err != nil {
+		lookupErrorsTotal.WithLabelValues(m.edition).Inc()
+		return nil, err
+	}
+	return record.(*webServiceRecord), nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// WEBSOCKET_PING_INTERVAL is how often the WebSocket connections are pinged, closed when no pong (or message) comes
+// back in twice that time, or when a result is not written in that time (ex: to a client not reading them)
+const WEBSOCKET_PING_INTERVAL time.Duration = 30 * time.Second
+
+// WEBSOCKET_MAX_MESSAGE_SIZE is the maximum size of the messages, an IP per message
+const WEBSOCKET_MAX_MESSAGE_SIZE int64 = 1024
+
+// websocketStreams are the open WebSocket connections, closed on shutdown as the server does not track the hijacked
+// connections
+type websocketStreams struct {
+	mutex sync.Mutex
+	conns map[*websocket.Conn]struct{}
+}
+
+func newWebsocketStreams() *websocketStreams {
+	return &websocketStreams{conns: map[*websocket.Conn]struct{}{}}
+}
+
+func (s *websocketStreams) add(conn *websocket.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.conns[conn] = struct{}{}
+}
+
+func (s *websocketStreams) remove(conn *websocket.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, conn)
+}
+
+// closeAll closes the open streams with a "going away" close message, for the clients to reconnect to another replica
+func (s *websocketStreams) closeAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down")
+	for conn := range s.conns {
+		_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
+
+// websocketHandler looks up the IPs sent as the text messages of a WebSocket, answering each with a JSON message of its
+// result in order (a batchErrorStruct on failure, keeping the connection open), for the log enrichment pipelines
+// streaming thousands of lookups per second without an HTTP request each. ?fields= and ?lang= apply to every result.
+func websocketHandler(lookup lookupFunc, cors *corsPolicy, streams *websocketStreams) httprouter.Handle {
+	upgrader := websocket.Upgrader{
+		// The browsers only connect from the allowed origins, the other clients send no Origin
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || cors.allows(origin)
+		},
+		Error: func(w http.ResponseWriter, _ *http.Request, status int, reason error) {
+			log.Info().Err(reason).Msg("WebSocket handshake failed")
+			errResponse(w, status, ERR_WEBSOCKET_HANDSHAKE, "Expected a WebSocket handshake from an allowed origin")
+		},
+	}
+
+	return func(w http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+		var json = jsoniter.ConfigCompatibleWithStandardLibrary
+		// The upgrader answers the failed handshakes itself
+		conn, err := upgrader.Upgrade(w, request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		streams.add(conn)
+		defer streams.remove(conn)
+		log.Info().Msg("WebSocket lookup stream opened")
+
+		fields := requestFields(request)
+		langs := requestLanguages(request)
+		alive := func() error {
+			return conn.SetReadDeadline(time.Now().Add(2 * WEBSOCKET_PING_INTERVAL))
+		}
+		conn.SetReadLimit(WEBSOCKET_MAX_MESSAGE_SIZE)
+		conn.SetPongHandler(func(string) error { return alive() })
+		_ = alive()
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(WEBSOCKET_PING_INTERVAL)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					// WriteControl is the write allowed concurrently with those of the results
+					if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WEBSOCKET_PING_INTERVAL)); err != nil {
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				// Closed by closeAll on shutdown otherwise
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, net.ErrClosed) {
+					log.Info().Err(err).Msg("WebSocket lookup stream failed")
+				}
+				return
+			}
+			_ = alive()
+			if messageType != websocket.TextMessage {
+				continue
+			}
+
+			result, err := json.Marshal(batchResult(request.Context(), lookup, strings.TrimSpace(string(message)), langs, fields))
+			if err != nil {
+				log.Error().Err(err).Msg("")
+				return
+			}
+			// Not to block forever on a client not reading the results, the read deadline only applies to the reads
+			_ = conn.SetWriteDeadline(time.Now().Add(WEBSOCKET_PING_INTERVAL))
+			if err := conn.WriteMessage(websocket.TextMessage, result); err != nil {
+				log.Info().Err(err).Msg("WebSocket lookup stream failed")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// WHOIS_IDLE_TIMEOUT closes the whois connections not sending a line for that long
+const WHOIS_IDLE_TIMEOUT time.Duration = 30 * time.Second
+
+// WHOIS_FORMAT aligns the columns of the whois records, as the Team Cymru ones
+const WHOIS_FORMAT string = "%-8s| %-16s| %-20s| %-3s| %-7s| %-20s| %s"
+
+var whoisHeader = fmt.Sprintf(WHOIS_FORMAT, "AS", "IP", "Network", "CC", "Region", "City", "AS Name")
+
+// whoisServer answers the IPs sent per line over TCP with a pipe delimited record, like the Team Cymru whois
+// interface: a single query (ex: `whois -h localhost -p 4343 8.8.8.8`), or a bulk of them between "begin" and "end"
+// lines (ex: `netcat localhost 4343 < ips.txt`)
+type whoisServer struct {
+	lookup lookupFunc
+}
+
+// serveWhois accepts the whois connections on address
+func serveWhois(server *whoisServer, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg(fmt.Sprintf("Serving whois on '%s'", address))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go server.serve(conn)
+	}
+}
+
+func (s *whoisServer) serve(conn net.Conn) {
+	defer conn.Close()
+	lines := bufio.NewScanner(conn)
+	out := bufio.NewWriter(conn)
+	next := func() (string, bool) {
+		_ = conn.SetReadDeadline(time.Now().Add(WHOIS_IDLE_TIMEOUT))
+		if !lines.Scan() {
+			return "", false
+		}
+		return strings.TrimSpace(lines.Text()), true
+	}
+
+	line, ok := next()
+	if !ok {
+		return
+	}
+	if !strings.EqualFold(line, "begin") {
+		// The flags of the Team Cymru single queries (ex: " -v 8.8.8.8") are only ignored, the records are verbose
+		fields := strings.Fields(line)
+		query := ""
+		for _, field := range fields {
+			if !strings.HasPrefix(field, "-") {
+				query = field
+			}
+		}
+		s.write(out, whoisHeader)
+		s.write(out, s.record(query, 1))
+		if err := out.Flush(); err != nil {
+			log.Info().Err(err).Msg("Whois write failed")
+		}
+		return
+	}
+
+	s.write(out, fmt.Sprintf("Bulk mode; geoip-server [%s]", time.Now().UTC().Format("2006-01-02 15:04:05 -0700")))
+	for number := 2; ; number++ {
+		line, ok := next()
+		if !ok || strings.EqualFold(line, "end") {
+			break
+		}
+		switch strings.ToLower(line) {
+		case "":
+		case "verbose", "header":
+			s.write(out, whoisHeader)
+		// The other options of the Team Cymru clients, without effect
+		case "noheader", "noverbose", "asnumber", "prefix", "countrycode", "notruncate":
+		default:
+			s.write(out, s.record(line, number))
+		}
+		// Answers each line once read, for the clients waiting for them before sending more
+		if err := out.Flush(); err != nil {
+			log.Info().Err(err).Msg("Whois write failed")
+			return
+		}
+	}
+	if err := lines.Err(); err != nil {
+		log.Info().Err(err).Msg("Whois read failed")
+	}
+}
+
+func (s *whoisServer) write(out *bufio.Writer, line string) {
+	_, _ = out.WriteString(line + "\n")
+}
+
+// record is the whois record of the IP of a line, or its error, with NA for the missing fields
+func (s *whoisServer) record(query string, number int) string {
+	ip := net.ParseIP(query)
+	if ip == nil {
+		log.Info().Msg(fmt.Sprintf("Invalid IP: '%s'", logIP(query)))
+		return fmt.Sprintf("Error: no IP match on line %d.", number)
+	}
+	ipStr := ip.String()
+	log.Info().Msg(fmt.Sprintf("Looking up IP '%s' (whois)", logIP(ipStr)))
+
+	var summary ipSummary
+	if !isBogon(ip) {
+		resp, err := s.lookup(context.Background(), ipStr, ip, nil)
+		if err != nil {
+			var statusErr lookupStatusError
+			if !errors.As(err, &statusErr) {
+				log.Err(err).Msg("Lookup error")
+				return fmt.Sprintf("Error: lookup failed on line %d.", number)
+			}
+		}
+		summary = summarize(resp)
+		// Not in the databases, the network is the empty range around the IP
+		if summary.CountryCode == "" && summary.ASN == 0 {
+			summary = ipSummary{}
+		}
+	}
+
+	na := func(value string) string {
+		if value == "" {
+			return "NA"
+		}
+		return value
+	}
+	asn := "NA"
+	if summary.ASN != 0 {
+		asn = strconv.FormatUint(uint64(summary.ASN), 10)
+	}
+	return fmt.Sprintf(
+		WHOIS_FORMAT,
+		asn, ipStr, na(summary.Network), na(summary.CountryCode), na(summary.Region), na(summary.City), na(summary.ASOrg),
+	)
+}